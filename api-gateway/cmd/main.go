@@ -9,9 +9,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aaronwang/bidding-app/api-gateway/internal/fx"
 	"github.com/aaronwang/bidding-app/api-gateway/internal/handlers"
+	"github.com/aaronwang/bidding-app/api-gateway/internal/notify"
 	redisClient "github.com/aaronwang/bidding-app/api-gateway/internal/redis"
+	"github.com/aaronwang/bidding-app/api-gateway/internal/scheduler"
 	"github.com/aaronwang/bidding-app/api-gateway/internal/service"
+	"github.com/aaronwang/bidding-app/shared/auth"
 	"github.com/aaronwang/bidding-app/shared/config"
 	"github.com/nats-io/nats.go"
 )
@@ -32,6 +36,12 @@ func main() {
 	defer redis.Close()
 	fmt.Printf("Connected to Redis with %s strategy\n", cfg.RedisStrategy)
 
+	// Convert amounts stored by earlier versions to integer minor units
+	if err := redis.MigrateMoney(context.Background()); err != nil {
+		fmt.Printf("Failed to migrate amounts: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Initialize NATS connection
 	fmt.Println("Connecting to NATS...")
 	natsConn, err := nats.Connect(cfg.NatsURL)
@@ -42,16 +52,98 @@ func main() {
 	defer natsConn.Close()
 	fmt.Println("Connected to NATS")
 
+	// Load exchange rates for display conversion (optional)
+	var rates fx.RateProvider
+	if cfg.FXRatesFile != "" {
+		staticRates, err := fx.NewStaticProvider(cfg.FXRatesFile)
+		if err != nil {
+			fmt.Printf("Failed to load exchange rates: %v\n", err)
+			os.Exit(1)
+		}
+		rates = staticRates
+		fmt.Printf("Loaded exchange rates from %s\n", cfg.FXRatesFile)
+	}
+
+	// Deliver personal notifications (outbid) to the user's WebSocket connections,
+	// and to a webhook and by email when configured
+	deliverers := []notify.Deliverer{notify.NewUserChannel(natsConn)}
+	if cfg.NotifyWebhookURL != "" {
+		deliverers = append(deliverers, notify.NewWebhook(cfg.NotifyWebhookURL))
+	}
+	if cfg.NotifySMTPAddr != "" {
+		deliverers = append(deliverers, notify.NewEmail(cfg.NotifySMTPAddr, cfg.NotifyEmailFrom, cfg.NotifyEmailDomain))
+	}
+	notifier := notify.New(deliverers, cfg.NotifyRetry)
+	notifyCtx, stopNotifier := context.WithCancel(context.Background())
+	defer stopNotifier()
+	go notifier.Run(notifyCtx)
+	fmt.Printf("Notifier started (%d channels)\n", len(deliverers))
+
 	// Initialize services
-	biddingService, err := service.NewBiddingService(redis, natsConn)
+	biddingService, err := service.NewBiddingService(redis, natsConn, cfg.BuyNowThreshold, rates, cfg.RateLimits, notifier)
 	if err != nil {
 		fmt.Printf("Failed to initialize bidding service: %v\n", err)
 		os.Exit(1)
 	}
 	fmt.Println("Bidding service initialized with JetStream")
 
+	// Answer Dutch clock lookups from the broadcast service
+	clockSub, err := biddingService.ServeClockRequests()
+	if err != nil {
+		fmt.Printf("Failed to serve clock requests: %v\n", err)
+		os.Exit(1)
+	}
+	defer clockSub.Unsubscribe()
+
+	// Answer item snapshot lookups for new watchers
+	snapshotSub, err := biddingService.ServeSnapshotRequests()
+	if err != nil {
+		fmt.Printf("Failed to serve snapshot requests: %v\n", err)
+		os.Exit(1)
+	}
+	defer snapshotSub.Unsubscribe()
+
+	// Relay accepted bids and closed auctions from the Redis outbox to JetStream for archival
+	if err := biddingService.EnsureOutbox(context.Background()); err != nil {
+		fmt.Printf("Failed to prepare the outbox: %v\n", err)
+		os.Exit(1)
+	}
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	relay := scheduler.NewOutboxRelay(biddingService, cfg.OutboxRetryAfter, cfg.OutboxMaxDeliveries)
+	go relay.Run(relayCtx)
+	fmt.Printf("Outbox relay started (retry after: %s, max deliveries: %d)\n", cfg.OutboxRetryAfter, cfg.OutboxMaxDeliveries)
+
+	// Start the auction closer (closes items once their end time has passed)
+	closerCtx, stopCloser := context.WithCancel(context.Background())
+	defer stopCloser()
+	if cfg.CloserEnabled {
+		closer := scheduler.NewAuctionCloser(biddingService, cfg.CloserInterval, int64(cfg.CloserBatchSize))
+		go closer.Run(closerCtx)
+		fmt.Printf("Auction closer started (interval: %s)\n", cfg.CloserInterval)
+	}
+
+	// Authenticate API requests with signed JWTs (off when no key is configured)
+	var verifier *auth.Verifier
+	if cfg.JWTSecret != "" || cfg.JWKSFile != "" {
+		verifier, err = auth.NewVerifier(auth.Config{
+			HMACSecret: cfg.JWTSecret,
+			JWKSFile:   cfg.JWKSFile,
+			Issuer:     cfg.JWTIssuer,
+			Audience:   cfg.JWTAudience,
+			Leeway:     30 * time.Second,
+		})
+		if err != nil {
+			fmt.Printf("Failed to initialize authentication: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("JWT authentication enabled")
+	} else {
+		fmt.Println("Warning: JWT authentication disabled, bids use the user_id of the request body")
+	}
+
 	// Initialize HTTP handlers
-	handler := handlers.NewHandler(biddingService)
+	handler := handlers.NewHandler(biddingService, verifier, cfg.ClientIPHeader)
 	router := handler.SetupRoutes()
 
 	// Create HTTP server
@@ -78,6 +170,9 @@ func main() {
 	<-quit
 
 	fmt.Println("\nShutting down server...")
+	stopCloser()
+	stopRelay()
+	stopNotifier()
 
 	// Graceful shutdown with 30 second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -98,6 +193,40 @@ type Config struct {
 	RedisDB       int
 	RedisStrategy string // "lua" or "optimistic"
 	NatsURL       string
+
+	// Auction closer settings
+	CloserEnabled   bool
+	CloserInterval  time.Duration
+	CloserBatchSize int
+
+	// How long an outbox entry stays unacknowledged before it is relayed again
+	OutboxRetryAfter time.Duration
+
+	// Reads after which an entry JetStream keeps rejecting is dead-lettered (0 = never)
+	OutboxMaxDeliveries int
+
+	// Percent of the buy-now price bidding may reach before buy-now is withdrawn
+	BuyNowThreshold int
+
+	// JSON file of exchange rates for display conversion (empty disables it)
+	FXRatesFile string
+
+	// JWT authentication (disabled when neither JWTSecret nor JWKSFile is set)
+	JWTSecret   string // HS256 shared secret
+	JWKSFile    string // Local JWKS file with RS256 public keys
+	JWTIssuer   string // Required issuer (optional)
+	JWTAudience string // Required audience (optional)
+
+	// Personal notifications (the WebSocket channel is always on)
+	NotifyWebhookURL  string // Webhook called with every notification (empty disables it)
+	NotifySMTPAddr    string // SMTP server for email notifications (empty disables them)
+	NotifyEmailFrom   string
+	NotifyEmailDomain string // Mail goes to {userID}@{domain}
+	NotifyRetry       notify.RetryPolicy
+
+	// Bid rate limits (a zero rate disables a scope)
+	RateLimits     service.RateLimits
+	ClientIPHeader string // Header with the client IP behind a proxy (empty uses the connection's address)
 }
 
 // loadConfig loads configuration from environment variables
@@ -109,5 +238,47 @@ func loadConfig() *Config {
 		RedisDB:       config.GetEnvInt("REDIS_DB", 0),
 		RedisStrategy: config.GetEnv("REDIS_STRATEGY", "lua"), // Default to Lua
 		NatsURL:       config.GetEnv("NATS_URL", "nats://localhost:4222"),
+
+		CloserEnabled:   config.GetEnvBool("AUCTION_CLOSER_ENABLED", true),
+		CloserInterval:  time.Duration(config.GetEnvInt("AUCTION_CLOSER_INTERVAL_MS", 1000)) * time.Millisecond,
+		CloserBatchSize: config.GetEnvInt("AUCTION_CLOSER_BATCH_SIZE", 100),
+
+		OutboxRetryAfter:    time.Duration(config.GetEnvInt("OUTBOX_RETRY_AFTER_MS", 5000)) * time.Millisecond,
+		OutboxMaxDeliveries: config.GetEnvInt("OUTBOX_MAX_DELIVERIES", 10),
+
+		BuyNowThreshold: config.GetEnvInt("BUY_NOW_THRESHOLD_PERCENT", 0),
+
+		FXRatesFile: config.GetEnv("FX_RATES_FILE", ""),
+
+		JWTSecret:   config.GetEnv("JWT_HMAC_SECRET", ""),
+		JWKSFile:    config.GetEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:   config.GetEnv("JWT_ISSUER", ""),
+		JWTAudience: config.GetEnv("JWT_AUDIENCE", ""),
+
+		NotifyWebhookURL:  config.GetEnv("NOTIFY_WEBHOOK_URL", ""),
+		NotifySMTPAddr:    config.GetEnv("NOTIFY_SMTP_ADDR", ""),
+		NotifyEmailFrom:   config.GetEnv("NOTIFY_EMAIL_FROM", "notifications@bidding.local"),
+		NotifyEmailDomain: config.GetEnv("NOTIFY_EMAIL_DOMAIN", "bidding.local"),
+		NotifyRetry: notify.RetryPolicy{
+			MaxAttempts: config.GetEnvInt("NOTIFY_MAX_ATTEMPTS", 5),
+			Backoff:     time.Duration(config.GetEnvInt("NOTIFY_RETRY_BACKOFF_MS", 1000)) * time.Millisecond,
+			MaxBackoff:  time.Minute,
+		},
+
+		RateLimits: service.RateLimits{
+			User: service.RateRule{
+				PerSecond: config.GetEnvInt("RATE_LIMIT_USER_PER_SEC", 10),
+				Burst:     config.GetEnvInt("RATE_LIMIT_USER_BURST", 20),
+			},
+			IP: service.RateRule{
+				PerSecond: config.GetEnvInt("RATE_LIMIT_IP_PER_SEC", 50),
+				Burst:     config.GetEnvInt("RATE_LIMIT_IP_BURST", 100),
+			},
+			Item: service.RateRule{
+				PerSecond: config.GetEnvInt("RATE_LIMIT_ITEM_PER_SEC", 500),
+				Burst:     config.GetEnvInt("RATE_LIMIT_ITEM_BURST", 1000),
+			},
+		},
+		ClientIPHeader: config.GetEnv("CLIENT_IP_HEADER", ""),
 	}
 }
@@ -0,0 +1,25 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// ErrRateUnavailable is returned when a provider has no rate for a currency pair
+var ErrRateUnavailable = errors.New("exchange rate not available")
+
+// RateProvider supplies exchange rates for display conversion
+// Converted amounts are informational only: bids are always placed, compared
+// and stored in the item's own currency
+type RateProvider interface {
+	// Rate returns how many units of to one unit of from buys
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+// Convert converts an amount with a rate, rounding to the nearest minor unit
+func Convert(amount models.Money, rate float64) models.Money {
+	return models.Money(math.Round(float64(amount) * rate))
+}
@@ -0,0 +1,68 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StaticProvider serves fixed rates loaded from a JSON file:
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "GBP": 0.79}}
+//
+// Each rate is the price of one unit of base in that currency; cross rates
+// (EUR -> GBP) are derived through the base
+type StaticProvider struct {
+	base  string
+	rates map[string]float64
+}
+
+// staticRates is the file format of StaticProvider
+type staticRates struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// NewStaticProvider loads the rates file at path
+func NewStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+
+	var file staticRates
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file: %w", err)
+	}
+	if file.Base == "" {
+		return nil, fmt.Errorf("rates file has no base currency")
+	}
+
+	p := &StaticProvider{
+		base:  strings.ToUpper(file.Base),
+		rates: make(map[string]float64, len(file.Rates)+1),
+	}
+	for currency, rate := range file.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %v for %s", rate, currency)
+		}
+		p.rates[strings.ToUpper(currency)] = rate
+	}
+	p.rates[p.base] = 1
+	return p, nil
+}
+
+// Rate returns how many units of to one unit of from buys
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (float64, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrRateUnavailable, from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrRateUnavailable, to)
+	}
+	return toRate / fromRate, nil
+}
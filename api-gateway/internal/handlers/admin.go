@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aaronwang/bidding-app/api-gateway/internal/policy"
+	"github.com/gorilla/mux"
+)
+
+// ForceCloseItem closes any open auction, regardless of its seller
+func (h *Handler) ForceCloseItem(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["id"]
+
+	if err := h.authorize(r, policy.ActionForceClose, "", ""); err != nil {
+		respondItemError(w, err, "Failed to close item")
+		return
+	}
+
+	item, err := h.biddingService.CloseItem(r.Context(), itemID)
+	if err != nil {
+		respondItemError(w, err, "Failed to close item")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// ResetPrice discards all bids on an open item, restarting it at its start price
+func (h *Handler) ResetPrice(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["id"]
+
+	if err := h.authorize(r, policy.ActionResetPrice, "", ""); err != nil {
+		respondItemError(w, err, "Failed to reset price")
+		return
+	}
+
+	item, err := h.biddingService.ResetPrice(r.Context(), itemID)
+	if err != nil {
+		respondItemError(w, err, "Failed to reset price")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// BanUser bans a user from bidding, buying and managing items
+func (h *Handler) BanUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	if err := h.authorize(r, policy.ActionBanUser, "", ""); err != nil {
+		respondItemError(w, err, "Failed to ban user")
+		return
+	}
+
+	if err := h.biddingService.BanUser(r.Context(), userID); err != nil {
+		respondItemError(w, err, "Failed to ban user")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"banned":  true,
+	})
+}
+
+// UnbanUser lifts the ban of a user
+func (h *Handler) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	if err := h.authorize(r, policy.ActionBanUser, "", ""); err != nil {
+		respondItemError(w, err, "Failed to unban user")
+		return
+	}
+
+	if err := h.biddingService.UnbanUser(r.Context(), userID); err != nil {
+		respondItemError(w, err, "Failed to unban user")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"banned":  false,
+	})
+}
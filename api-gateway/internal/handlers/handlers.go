@@ -2,23 +2,45 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aaronwang/bidding-app/api-gateway/internal/policy"
 	"github.com/aaronwang/bidding-app/api-gateway/internal/service"
+	"github.com/aaronwang/bidding-app/shared/auth"
 	"github.com/aaronwang/bidding-app/shared/models"
 	"github.com/gorilla/mux"
 )
 
+// maxIdempotencyKeyLength bounds the Idempotency-Key header of bid requests
+const maxIdempotencyKeyLength = 255
+
 // Handler contains HTTP request handlers
 type Handler struct {
 	biddingService *service.BiddingService
+	verifier       *auth.Verifier // Validates bearer tokens (nil disables authentication)
+	policy         *policy.Policy // Decides which caller may perform which action
+	clientIPHeader string         // Header with the client IP set by a trusted proxy (empty for none)
 }
 
 // NewHandler creates a new HTTP handler
-func NewHandler(biddingService *service.BiddingService) *Handler {
+// verifier authenticates API requests, nil disables authentication and with it
+// the role checks of the policy
+// clientIPHeader names the header a trusted proxy puts the client IP in (e.g.
+// X-Forwarded-For), empty uses the connection's remote address
+func NewHandler(biddingService *service.BiddingService, verifier *auth.Verifier, clientIPHeader string) *Handler {
 	return &Handler{
 		biddingService: biddingService,
+		verifier:       verifier,
+		policy:         policy.New(verifier != nil),
+		clientIPHeader: clientIPHeader,
 	}
 }
 
@@ -29,10 +51,22 @@ func (h *Handler) SetupRoutes() *mux.Router {
 	// Health check
 	router.HandleFunc("/health", h.HealthCheck).Methods("GET")
 
+	// Metrics (expvar JSON, e.g. the bid rate limiter's decisions)
+	router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+
 	// API routes
 	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/items", h.CreateItem).Methods("POST")
 	api.HandleFunc("/items/{id}", h.GetItem).Methods("GET")
+	api.HandleFunc("/items/{id}", h.UpdateItem).Methods("PATCH")
+	api.HandleFunc("/items/{id}/close", h.CloseItem).Methods("POST")
 	api.HandleFunc("/items/{id}/bid", h.PlaceBid).Methods("POST")
+	api.HandleFunc("/items/{id}/buy", h.BuyNow).Methods("POST")
+	api.HandleFunc("/admin/items/{id}/close", h.ForceCloseItem).Methods("POST")
+	api.HandleFunc("/admin/items/{id}/reset-price", h.ResetPrice).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/ban", h.BanUser).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/ban", h.UnbanUser).Methods("DELETE")
+	api.Use(h.authMiddleware)
 
 	// Middleware
 	router.Use(loggingMiddleware)
@@ -51,6 +85,7 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetItem retrieves current bid information for an item
+// ?display_currency=EUR adds the amounts converted to EUR for display
 func (h *Handler) GetItem(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	itemID := vars["id"]
@@ -61,9 +96,133 @@ func (h *Handler) GetItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	item, err := h.biddingService.GetItemBid(ctx, itemID)
+	var item *models.Item
+	var err error
+	if displayCurrency := strings.ToUpper(r.URL.Query().Get("display_currency")); displayCurrency != "" {
+		if !models.ValidCurrency(displayCurrency) {
+			respondError(w, http.StatusBadRequest, "display_currency must be a 3-letter ISO 4217 code")
+			return
+		}
+		item, err = h.biddingService.GetItemInCurrency(ctx, itemID, displayCurrency)
+	} else {
+		item, err = h.biddingService.GetItem(ctx, itemID)
+	}
+	if err != nil {
+		respondItemError(w, err, "Failed to retrieve item")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// CreateItem handles auction item creation requests
+func (h *Handler) CreateItem(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authorize(r, policy.ActionCreateItem, "", req.SellerID); err != nil {
+		respondItemError(w, err, "Failed to create item")
+		return
+	}
+
+	ctx := r.Context()
+	item, err := h.biddingService.CreateItem(ctx, &req)
+	if err != nil {
+		respondItemError(w, err, "Failed to create item")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, item)
+}
+
+// UpdateItem handles partial updates of an auction item
+func (h *Handler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID := vars["id"]
+
+	if itemID == "" {
+		respondError(w, http.StatusBadRequest, "Item ID is required")
+		return
+	}
+
+	var req models.UpdateItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authorize(r, policy.ActionUpdateItem, itemID, ""); err != nil {
+		respondItemError(w, err, "Failed to update item")
+		return
+	}
+
+	ctx := r.Context()
+	item, err := h.biddingService.UpdateItem(ctx, itemID, &req)
+	if err != nil {
+		respondItemError(w, err, "Failed to update item")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// CloseItem closes an auction before (or at) its scheduled end time
+func (h *Handler) CloseItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID := vars["id"]
+
+	if itemID == "" {
+		respondError(w, http.StatusBadRequest, "Item ID is required")
+		return
+	}
+
+	if err := h.authorize(r, policy.ActionCloseItem, itemID, ""); err != nil {
+		respondItemError(w, err, "Failed to close item")
+		return
+	}
+
+	ctx := r.Context()
+	item, err := h.biddingService.CloseItem(ctx, itemID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to retrieve item")
+		respondItemError(w, err, "Failed to close item")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// BuyNow wins an item at its buy-now price, closing the auction
+func (h *Handler) BuyNow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID := vars["id"]
+
+	if itemID == "" {
+		respondError(w, http.StatusBadRequest, "Item ID is required")
+		return
+	}
+
+	var req models.BuyNowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == "" && !hasCaller(r) {
+		respondError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	if err := h.authorize(r, policy.ActionBuyNow, itemID, req.UserID); err != nil {
+		respondItemError(w, err, "Failed to buy item")
+		return
+	}
+
+	ctx := r.Context()
+	item, err := h.biddingService.BuyNow(ctx, itemID, &req)
+	if err != nil {
+		respondItemError(w, err, "Failed to buy item")
 		return
 	}
 
@@ -80,6 +239,14 @@ func (h *Handler) PlaceBid(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Throttle before any other work (reading the body, authorization, the bid), so
+	// a flood of bids costs a single Redis call each; the body isn't read yet, so the
+	// per-user limit applies to authenticated callers only
+	if err := h.biddingService.CheckBidRateLimit(r.Context(), itemID, callerID(r), h.clientIP(r)); err != nil {
+		respondItemError(w, err, "Failed to place bid")
+		return
+	}
+
 	// Parse request body
 	var bidReq models.BidRequest
 	if err := json.NewDecoder(r.Body).Decode(&bidReq); err != nil {
@@ -87,21 +254,46 @@ func (h *Handler) PlaceBid(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate request
-	if bidReq.UserID == "" {
+	// Validate request (an authenticated caller replaces the body's user ID)
+	if bidReq.UserID == "" && !hasCaller(r) {
 		respondError(w, http.StatusBadRequest, "User ID is required")
 		return
 	}
-	if bidReq.Amount <= 0 {
+	if bidReq.MaxAmount < 0 {
+		respondError(w, http.StatusBadRequest, "Maximum bid must be positive")
+		return
+	}
+	if bidReq.Amount < 0 || (bidReq.Amount == 0 && bidReq.MaxAmount == 0) {
 		respondError(w, http.StatusBadRequest, "Bid amount must be positive")
 		return
 	}
+	if bidReq.MaxAmount > 0 && bidReq.Amount > bidReq.MaxAmount {
+		respondError(w, http.StatusBadRequest, "Bid amount must not exceed the maximum bid")
+		return
+	}
+	// Retries with the same Idempotency-Key get the first result instead of bidding again
+	bidReq.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if len(bidReq.IdempotencyKey) > maxIdempotencyKeyLength {
+		respondError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return
+	}
+	// Bids must be in the item's currency; the service checks it matches
+	bidReq.Currency = strings.ToUpper(bidReq.Currency)
+	if bidReq.Currency != "" && !models.ValidCurrency(bidReq.Currency) {
+		respondError(w, http.StatusBadRequest, "Currency must be a 3-letter ISO 4217 code")
+		return
+	}
+
+	if err := h.authorize(r, policy.ActionBid, itemID, bidReq.UserID); err != nil {
+		respondItemError(w, err, "Failed to place bid")
+		return
+	}
 
 	// Place bid
 	ctx := r.Context()
 	response, err := h.biddingService.PlaceBid(ctx, itemID, &bidReq)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to place bid")
+		respondItemError(w, err, "Failed to place bid")
 		return
 	}
 
@@ -114,6 +306,22 @@ func (h *Handler) PlaceBid(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, statusCode, response)
 }
 
+// clientIP returns the IP address of the client of a request: the first address
+// of the configured proxy header, or the connection's remote address
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.clientIPHeader != "" {
+		if value := r.Header.Get(h.clientIPHeader); value != "" {
+			first, _, _ := strings.Cut(value, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // respondJSON sends a JSON response
 func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -128,6 +336,37 @@ func respondError(w http.ResponseWriter, statusCode int, message string) {
 	})
 }
 
+// respondItemError maps item lifecycle errors to HTTP status codes
+// Unknown errors are reported as 500 with the given fallback message
+func respondItemError(w http.ResponseWriter, err error, fallback string) {
+	var limited *service.RateLimitedError
+	switch {
+	case errors.As(err, &limited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+		respondError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many bids (%s limit), retry later", limited.Scope))
+	case errors.Is(err, service.ErrInvalidItem), errors.Is(err, service.ErrDisplayCurrency):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, policy.ErrForbidden):
+		respondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrItemNotFound):
+		respondError(w, http.StatusNotFound, "Item not found")
+	case errors.Is(err, service.ErrItemExists):
+		respondError(w, http.StatusConflict, "Item already exists")
+	case errors.Is(err, service.ErrItemClosed):
+		respondError(w, http.StatusConflict, "Item is closed")
+	case errors.Is(err, service.ErrAuctionNotOpen):
+		respondError(w, http.StatusConflict, "Auction is not open")
+	case errors.Is(err, service.ErrBuyNowUnavailable):
+		respondError(w, http.StatusConflict, "Buy-now is not available for this item")
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		respondError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for another item")
+	case errors.Is(err, service.ErrAuctionStarted):
+		respondError(w, http.StatusConflict, "Auction has already started, only name and description can be changed")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
 // loggingMiddleware logs all HTTP requests
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -144,8 +383,8 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
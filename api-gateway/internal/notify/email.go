@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email delivers notifications as plain-text mail over SMTP, without
+// authentication or TLS: it is meant for a local SMTP stand-in (e.g. MailHog)
+// There is no user directory yet, so mail goes to {userID}@{domain}
+type Email struct {
+	addr   string // SMTP server host:port
+	from   string
+	domain string
+}
+
+// NewEmail creates a deliverer sending through the SMTP server at addr
+func NewEmail(addr, from, domain string) *Email {
+	return &Email{addr: addr, from: from, domain: domain}
+}
+
+// Name identifies the channel in logs
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Deliver sends the notification's subject and text
+// net/smtp takes no context; the server is local, so a hung call is unlikely
+func (e *Email) Deliver(ctx context.Context, n *Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	to := fmt.Sprintf("%s@%s", n.UserID, e.domain)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", encodeHeader(n.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", n.ID, e.domain)
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := smtp.SendMail(e.addr, nil, e.from, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// encodeHeader makes text safe as a header value: line breaks are dropped, so it
+// can't start another header or the body, and non-ASCII text is Q-encoded
+func encodeHeader(text string) string {
+	text = strings.NewReplacer("\r", "", "\n", " ").Replace(text)
+	return mime.QEncoding.Encode("utf-8", text)
+}
@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeHeader(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"ascii", "You won Clock", "You won Clock"},
+		{"injection", "You won X\r\nBcc: victim@example.com\r\n\r\nbody", "You won X Bcc: victim@example.com  body"},
+		{"utf-8", "You won Ühr", "=?utf-8?q?You_won_=C3=9Chr?="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeHeader(tt.text)
+			if got != tt.want {
+				t.Errorf("encodeHeader(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if strings.ContainsAny(got, "\r\n") {
+				t.Errorf("encodeHeader(%q) contains a line break", tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// userIDPattern is the user ID format deliverers may put into NATS subjects and
+// mail addresses, the same as the gateway's item IDs
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Notifier settings
+const (
+	queueSize = 1000 // Pending deliveries; notifications beyond it are dropped
+	workers   = 4    // Concurrent deliveries
+)
+
+// Notification is a personal message for one user
+type Notification struct {
+	ID      string      // Unique per notification, sent along so receivers can deduplicate retries
+	UserID  string      // Recipient
+	Subject string      // One-line summary (the email subject)
+	Text    string      // Human-readable message (the email body)
+	Event   interface{} // Event for machine channels (WebSocket, webhook), sent as JSON
+}
+
+// Deliverer sends notifications over one channel
+// Deliver may be called again for the same notification after an error
+type Deliverer interface {
+	Name() string
+	Deliver(ctx context.Context, n *Notification) error
+}
+
+// RetryPolicy configures redelivery of failed notifications
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per channel, including the first
+	Backoff     time.Duration // Pause before the first retry, doubled for each further one
+	MaxBackoff  time.Duration // Longest pause between retries
+}
+
+// notifyMetrics counts deliveries, published at /debug/vars: "delivered",
+// "retried", "failed" (attempts exhausted), "dropped" (queue full) and
+// "rejected" (invalid user ID)
+var notifyMetrics = expvar.NewMap("notifications")
+
+// delivery is one notification on one channel
+type delivery struct {
+	deliverer    Deliverer
+	notification *Notification
+	attempt      int
+}
+
+// Notifier routes notifications to every configured channel in the background
+// Each channel is delivered and retried on its own, so a slow or failing webhook
+// doesn't hold up the others; deliveries are best effort and lost on restart
+type Notifier struct {
+	deliverers []Deliverer
+	retry      RetryPolicy
+	queue      chan *delivery
+}
+
+// New creates a notifier delivering over deliverers
+func New(deliverers []Deliverer, retry RetryPolicy) *Notifier {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	return &Notifier{
+		deliverers: deliverers,
+		retry:      retry,
+		queue:      make(chan *delivery, queueSize),
+	}
+}
+
+// Notify queues a notification on every channel without blocking
+// Notifications for user IDs outside userIDPattern are dropped
+func (n *Notifier) Notify(notification *Notification) {
+	if !userIDPattern.MatchString(notification.UserID) {
+		notifyMetrics.Add("rejected", 1)
+		fmt.Printf("[NOTIFY] Dropped notification %s for invalid user ID %q\n", notification.ID, notification.UserID)
+		return
+	}
+	for _, d := range n.deliverers {
+		n.enqueue(&delivery{deliverer: d, notification: notification, attempt: 1})
+	}
+}
+
+// enqueue queues a delivery, dropping it if the queue is full
+func (n *Notifier) enqueue(d *delivery) {
+	select {
+	case n.queue <- d:
+	default:
+		notifyMetrics.Add("dropped", 1)
+		fmt.Printf("[NOTIFY] Queue full, dropped %s notification %s for user %s\n",
+			d.deliverer.Name(), d.notification.ID, d.notification.UserID)
+	}
+}
+
+// Run delivers queued notifications until the context is cancelled
+// This should run in a goroutine
+func (n *Notifier) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					done <- struct{}{}
+					return
+				case d := <-n.queue:
+					n.deliver(ctx, d)
+				}
+			}
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-done
+	}
+}
+
+// deliver makes one delivery attempt and schedules a retry if it fails
+// The retry waits on a timer rather than in the worker, so other deliveries go on
+func (n *Notifier) deliver(ctx context.Context, d *delivery) {
+	deliverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	err := d.deliverer.Deliver(deliverCtx, d.notification)
+	cancel()
+	if err == nil {
+		notifyMetrics.Add("delivered", 1)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	if d.attempt >= n.retry.MaxAttempts {
+		notifyMetrics.Add("failed", 1)
+		fmt.Printf("[NOTIFY] Giving up %s notification %s for user %s after %d attempts: %v\n",
+			d.deliverer.Name(), d.notification.ID, d.notification.UserID, d.attempt, err)
+		return
+	}
+
+	backoff := n.backoff(d.attempt)
+	notifyMetrics.Add("retried", 1)
+	fmt.Printf("[NOTIFY] %s notification %s for user %s failed, retrying in %s: %v\n",
+		d.deliverer.Name(), d.notification.ID, d.notification.UserID, backoff, err)
+	d.attempt++
+	time.AfterFunc(backoff, func() {
+		if ctx.Err() == nil {
+			n.enqueue(d)
+		}
+	})
+}
+
+// backoff returns the pause after the given failed attempt
+func (n *Notifier) backoff(attempt int) time.Duration {
+	backoff := n.retry.Backoff
+	for i := 1; i < attempt && backoff < n.retry.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if n.retry.MaxBackoff > 0 && backoff > n.retry.MaxBackoff {
+		backoff = n.retry.MaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook delivers notifications by POSTing them as JSON to a URL:
+// {"id": ..., "user_id": ..., "subject": ..., "text": ..., "event": {...}}
+// Any non-2xx answer is retried; receivers deduplicate retries by id
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// webhookPayload is the body of a webhook call
+type webhookPayload struct {
+	ID      string      `json:"id"`
+	UserID  string      `json:"user_id"`
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Event   interface{} `json:"event"`
+}
+
+// NewWebhook creates a deliverer calling url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Name identifies the channel in logs
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Deliver POSTs the notification
+func (w *Webhook) Deliver(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		ID:      n.ID,
+		UserID:  n.UserID,
+		Subject: n.Subject,
+		Text:    n.Text,
+		Event:   n.Event,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-ID", n.ID)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// UserChannel delivers notifications to the user's WebSocket connections: the
+// event is published on user_events.{userID}, which the broadcast service
+// forwards to every connection the user has open on /ws/users/me
+// Users without an open connection miss it, like any live update
+type UserChannel struct {
+	nats *nats.Conn
+}
+
+// NewUserChannel creates a deliverer publishing on NATS
+func NewUserChannel(natsConn *nats.Conn) *UserChannel {
+	return &UserChannel{nats: natsConn}
+}
+
+// Name identifies the channel in logs
+func (c *UserChannel) Name() string {
+	return "websocket"
+}
+
+// Deliver publishes the notification's event
+func (c *UserChannel) Deliver(ctx context.Context, n *Notification) error {
+	data, err := json.Marshal(n.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := c.nats.Publish(fmt.Sprintf("user_events.%s", n.UserID), data); err != nil {
+		return fmt.Errorf("failed to publish user event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aaronwang/bidding-app/shared/auth"
+)
+
+// ErrForbidden is returned when the caller may not perform an action
+var ErrForbidden = errors.New("forbidden")
+
+// Action is something a caller does through the API
+type Action string
+
+// Actions checked by the handlers
+const (
+	ActionCreateItem Action = "create_item"
+	ActionUpdateItem Action = "update_item"
+	ActionCloseItem  Action = "close_item"
+	ActionBid        Action = "bid"
+	ActionBuyNow     Action = "buy_now"
+	ActionForceClose Action = "force_close"
+	ActionResetPrice Action = "reset_price"
+	ActionBanUser    Action = "ban_user"
+)
+
+// Subject is the caller of an action
+type Subject struct {
+	UserID string
+	Roles  []string
+	Banned bool
+}
+
+// Resource is the item an action applies to (zero for actions on no item)
+type Resource struct {
+	SellerID string // Empty for items listed before sellers were recorded
+}
+
+// rule decides one action for a caller with the given roles
+type rule struct {
+	roles      []string // Any of these roles may perform the action
+	ownerRoles []string // These roles may perform it on items they sell
+	notOwner   bool     // The seller of the item may never perform it (shill protection)
+	adminOnly  bool     // Unavailable when roles aren't enforced, since nobody can be an admin
+}
+
+// rules is the authorization table: every action the API exposes has one entry
+var rules = map[Action]rule{
+	ActionCreateItem: {roles: []string{auth.RoleSeller, auth.RoleAdmin}},
+	ActionUpdateItem: {roles: []string{auth.RoleAdmin}, ownerRoles: []string{auth.RoleSeller}},
+	ActionCloseItem:  {roles: []string{auth.RoleAdmin}, ownerRoles: []string{auth.RoleSeller}},
+	ActionBid:        {roles: []string{auth.RoleBidder}, notOwner: true},
+	ActionBuyNow:     {roles: []string{auth.RoleBidder}, notOwner: true},
+	ActionForceClose: {roles: []string{auth.RoleAdmin}, adminOnly: true},
+	ActionResetPrice: {roles: []string{auth.RoleAdmin}, adminOnly: true},
+	ActionBanUser:    {roles: []string{auth.RoleAdmin}, adminOnly: true},
+}
+
+// Policy decides whether a caller may perform an action
+type Policy struct {
+	enforceRoles bool
+}
+
+// New creates a policy
+// enforceRoles is false when authentication is disabled: callers then have no
+// roles, only the shill and ban checks of the caller's user ID apply and admin
+// actions are always forbidden
+func New(enforceRoles bool) *Policy {
+	return &Policy{enforceRoles: enforceRoles}
+}
+
+// Authorize returns nil if subject may perform action on resource, or an error
+// wrapping ErrForbidden that explains why not
+func (p *Policy) Authorize(subject Subject, action Action, resource Resource) error {
+	r, ok := rules[action]
+	if !ok {
+		return fmt.Errorf("%w: unknown action %q", ErrForbidden, action)
+	}
+
+	if subject.Banned {
+		return fmt.Errorf("%w: user %s is banned", ErrForbidden, subject.UserID)
+	}
+	owner := subject.UserID != "" && subject.UserID == resource.SellerID
+	if r.notOwner && owner {
+		return fmt.Errorf("%w: sellers may not %s on their own items", ErrForbidden, actionName(action))
+	}
+	if !p.enforceRoles {
+		if r.adminOnly {
+			return fmt.Errorf("%w: admin actions need authentication", ErrForbidden)
+		}
+		return nil
+	}
+
+	if hasAny(subject.Roles, r.roles) || (owner && hasAny(subject.Roles, r.ownerRoles)) {
+		return nil
+	}
+	return fmt.Errorf("%w: not allowed to %s", ErrForbidden, actionName(action))
+}
+
+// hasAny reports whether roles contains any of wanted
+func hasAny(roles, wanted []string) bool {
+	for _, role := range roles {
+		for _, w := range wanted {
+			if role == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// actionName returns the action for error messages ("reset_price" -> "reset price")
+func actionName(action Action) string {
+	name := []byte(action)
+	for i, c := range name {
+		if c == '_' {
+			name[i] = ' '
+		}
+	}
+	return string(name)
+}
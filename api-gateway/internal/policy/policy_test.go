@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aaronwang/bidding-app/shared/auth"
+)
+
+type authorizeTest struct {
+	subject  Subject
+	action   Action
+	resource Resource
+	wantErr  bool
+}
+
+var (
+	bidder       = Subject{UserID: "u1", Roles: []string{auth.RoleBidder}}
+	seller       = Subject{UserID: "u1", Roles: []string{auth.RoleSeller}}
+	admin        = Subject{UserID: "u1", Roles: []string{auth.RoleAdmin}}
+	sellerBidder = Subject{UserID: "u1", Roles: []string{auth.RoleSeller, auth.RoleBidder}}
+	noRoles      = Subject{UserID: "u1"}
+	anonymous    = Subject{}
+
+	ownItem    = Resource{SellerID: "u1"}
+	otherItem  = Resource{SellerID: "u2"}
+	legacyItem = Resource{} // Listed before sellers were recorded
+	noItem     = Resource{}
+)
+
+func banned(subject Subject) Subject {
+	subject.Banned = true
+	return subject
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []authorizeTest{
+		// Creating items
+		{bidder, ActionCreateItem, noItem, true},
+		{seller, ActionCreateItem, noItem, false},
+		{admin, ActionCreateItem, noItem, false},
+		{noRoles, ActionCreateItem, noItem, true},
+
+		// Updating items: admins, and sellers on their own items
+		{bidder, ActionUpdateItem, otherItem, true},
+		{bidder, ActionUpdateItem, ownItem, true},
+		{seller, ActionUpdateItem, otherItem, true},
+		{seller, ActionUpdateItem, ownItem, false},
+		{seller, ActionUpdateItem, legacyItem, true},
+		{admin, ActionUpdateItem, otherItem, false},
+		{noRoles, ActionUpdateItem, ownItem, true},
+
+		// Closing items: same as updating
+		{bidder, ActionCloseItem, otherItem, true},
+		{bidder, ActionCloseItem, ownItem, true},
+		{seller, ActionCloseItem, otherItem, true},
+		{seller, ActionCloseItem, ownItem, false},
+		{admin, ActionCloseItem, otherItem, false},
+		{noRoles, ActionCloseItem, ownItem, true},
+
+		// Bidding: bidders, never on their own items
+		{bidder, ActionBid, otherItem, false},
+		{bidder, ActionBid, legacyItem, false},
+		{bidder, ActionBid, ownItem, true},
+		{sellerBidder, ActionBid, otherItem, false},
+		{sellerBidder, ActionBid, ownItem, true},
+		{seller, ActionBid, otherItem, true},
+		{admin, ActionBid, otherItem, true},
+		{noRoles, ActionBid, otherItem, true},
+
+		// Buy-now: same as bidding
+		{bidder, ActionBuyNow, otherItem, false},
+		{bidder, ActionBuyNow, ownItem, true},
+		{sellerBidder, ActionBuyNow, ownItem, true},
+		{seller, ActionBuyNow, otherItem, true},
+		{admin, ActionBuyNow, otherItem, true},
+		{noRoles, ActionBuyNow, otherItem, true},
+
+		// Admin actions
+		{bidder, ActionForceClose, otherItem, true},
+		{seller, ActionForceClose, ownItem, true},
+		{admin, ActionForceClose, otherItem, false},
+		{noRoles, ActionForceClose, otherItem, true},
+		{bidder, ActionResetPrice, otherItem, true},
+		{seller, ActionResetPrice, ownItem, true},
+		{admin, ActionResetPrice, otherItem, false},
+		{noRoles, ActionResetPrice, otherItem, true},
+		{bidder, ActionBanUser, noItem, true},
+		{seller, ActionBanUser, noItem, true},
+		{admin, ActionBanUser, noItem, false},
+		{noRoles, ActionBanUser, noItem, true},
+
+		// Banned callers may do nothing, whatever their roles
+		{banned(bidder), ActionBid, otherItem, true},
+		{banned(seller), ActionCreateItem, noItem, true},
+		{banned(seller), ActionUpdateItem, ownItem, true},
+		{banned(admin), ActionBanUser, noItem, true},
+
+		// An anonymous caller owns no item, not even one without a seller
+		{anonymous, ActionBid, legacyItem, true},
+
+		// Unknown actions are forbidden
+		{admin, Action("delete_everything"), noItem, true},
+	}
+
+	runAuthorizeTests(t, New(true), tests)
+}
+
+// Without authentication callers have no roles: everything but admin actions is
+// allowed, except for the ban and shill checks of the body's user ID
+func TestAuthorizeWithoutRoles(t *testing.T) {
+	tests := []authorizeTest{
+		{noRoles, ActionCreateItem, noItem, false},
+		{noRoles, ActionUpdateItem, otherItem, false},
+		{noRoles, ActionUpdateItem, ownItem, false},
+		{noRoles, ActionCloseItem, otherItem, false},
+		{noRoles, ActionCloseItem, ownItem, false},
+		{noRoles, ActionBid, otherItem, false},
+		{noRoles, ActionBid, legacyItem, false},
+		{noRoles, ActionBid, ownItem, true},
+		{noRoles, ActionBuyNow, otherItem, false},
+		{noRoles, ActionBuyNow, ownItem, true},
+		{anonymous, ActionBid, legacyItem, false},
+
+		// Nobody can be an admin, whatever roles the subject claims
+		{noRoles, ActionForceClose, otherItem, true},
+		{noRoles, ActionResetPrice, otherItem, true},
+		{noRoles, ActionBanUser, noItem, true},
+		{admin, ActionForceClose, otherItem, true},
+		{admin, ActionResetPrice, otherItem, true},
+		{admin, ActionBanUser, noItem, true},
+
+		{banned(noRoles), ActionBid, otherItem, true},
+		{banned(noRoles), ActionCreateItem, noItem, true},
+		{noRoles, Action("delete_everything"), noItem, true},
+	}
+
+	runAuthorizeTests(t, New(false), tests)
+}
+
+func runAuthorizeTests(t *testing.T, policy *Policy, tests []authorizeTest) {
+	t.Helper()
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s/%v/banned=%v/seller=%q", tt.action, tt.subject.Roles, tt.subject.Banned, tt.resource.SellerID)
+		t.Run(name, func(t *testing.T) {
+			err := policy.Authorize(tt.subject, tt.action, tt.resource)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authorize(%+v, %s, %+v) = %v, want error: %v", tt.subject, tt.action, tt.resource, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrForbidden) {
+				t.Errorf("Authorize(%+v, %s, %+v) = %v, want ErrForbidden", tt.subject, tt.action, tt.resource, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// bannedUsersKey is the set of user IDs banned from all writes
+const bannedUsersKey = "users:banned"
+
+// resetPriceLua clears the bidding state of an open item so that the auction
+// starts over from its start price, and queues the reset in the outbox
+// Running in Redis with the bid script means no bid is half-applied around a reset
+const resetPriceLua = `
+	-- KEYS[1]: item:{itemID} (item metadata hash)
+	-- KEYS[2]: item:{itemID}:current_bid
+	-- KEYS[3]: item:{itemID}:highest_bidder
+	-- KEYS[4]: item:{itemID}:proxy_max
+	-- KEYS[5]: item:{itemID}:sealed_bids
+	-- KEYS[6]: outbox:{shard}
+	-- ARGV[1]: current time (unix ms)
+	-- ARGV[2]: item ID
+	-- ARGV[3]: user ID of the admin resetting the price
+	--
+	-- Returns {seq, start_price} with the item's new sequence number (the reset is
+	-- a price change), {-1} not found, {0} closed
+
+	local status = redis.call('HGET', KEYS[1], 'status')
+	if not status then
+		return {-1}
+	end
+	if status == 'closed' then
+		return {0}
+	end
+
+	redis.call('DEL', KEYS[2], KEYS[3], KEYS[4], KEYS[5])
+	redis.call('HSET', KEYS[1], 'bid_count', 0, 'updated_at', ARGV[1])
+	local seq = redis.call('HINCRBY', KEYS[1], 'seq', 1)
+	local item = redis.call('HMGET', KEYS[1], 'start_price', 'currency')
+	local start_price = item[1] or '0'
+	redis.call('XADD', KEYS[6], '*',
+		'kind', 'reset', 'item_id', ARGV[2], 'ts', ARGV[1], 'seq', seq,
+		'reset_by', ARGV[3], 'start_price', start_price, 'currency', item[2] or '')
+	return {seq, start_price}
+`
+
+// PriceReset is the outcome of a price reset
+type PriceReset struct {
+	StartPrice models.Money
+	MinNextBid models.Money // Lowest bid accepted after the reset
+	ResetBy    string       // Admin who reset the price
+	Seq        int64        // Item's sequence number after the reset
+}
+
+// ResetPrice discards all bids on an open item, including proxy maximums and
+// sealed bids, so that bidding restarts at the start price; the reset is queued
+// in the outbox like a bid
+// Returns ErrItemNotFound or ErrItemClosed if the item can't be reset
+func (c *Client) ResetPrice(ctx context.Context, itemID, resetBy string, now time.Time) (*PriceReset, error) {
+	keys := []string{
+		itemKey(itemID),
+		fmt.Sprintf("item:%s:current_bid", itemID),
+		fmt.Sprintf("item:%s:highest_bidder", itemID),
+		proxyKey(itemID),
+		sealedBidsKey(itemID),
+		outboxKey(outboxShard(itemID)),
+	}
+
+	result, err := c.resetPriceScript.Run(ctx, c.client, keys, now.UnixMilli(), itemID, resetBy).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset price: %w", err)
+	}
+	seq, _ := result[0].(int64)
+	switch seq {
+	case -1:
+		return nil, ErrItemNotFound
+	case 0:
+		return nil, ErrItemClosed
+	}
+	if len(result) != 2 {
+		return nil, fmt.Errorf("unexpected reset result: %v", result)
+	}
+	startPrice, _ := result[1].(string)
+	return newPriceReset(startPrice, resetBy, seq), nil
+}
+
+// newPriceReset returns the outcome of a reset to the start price stored in the
+// item hash (minor units)
+func newPriceReset(startPrice, resetBy string, seq int64) *PriceReset {
+	return &PriceReset{
+		StartPrice: parseMoney(startPrice),
+		MinNextBid: minNextBid(map[string]string{"start_price": startPrice}, 0, false),
+		ResetBy:    resetBy,
+		Seq:        seq,
+	}
+}
+
+// BanUser bans a user from bidding, buying and managing items
+func (c *Client) BanUser(ctx context.Context, userID string) error {
+	if err := c.client.SAdd(ctx, bannedUsersKey, userID).Err(); err != nil {
+		return fmt.Errorf("failed to ban user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// UnbanUser lifts the ban of a user
+func (c *Client) UnbanUser(ctx context.Context, userID string) error {
+	if err := c.client.SRem(ctx, bannedUsersKey, userID).Err(); err != nil {
+		return fmt.Errorf("failed to unban user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// IsBanned reports whether a user is banned
+func (c *Client) IsBanned(ctx context.Context, userID string) (bool, error) {
+	banned, err := c.client.SIsMember(ctx, bannedUsersKey, userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check ban of user %s: %w", userID, err)
+	}
+	return banned, nil
+}
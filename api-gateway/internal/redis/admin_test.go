@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// TestResetPriceAppendsOutbox checks that a price reset is queued in the outbox
+// after the bids it discards, with the item's next sequence number
+func TestResetPriceAppendsOutbox(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, "lua")
+
+	now := time.Now()
+	item := &models.Item{
+		ID:          "reset-1",
+		Name:        "Lamp",
+		StartPrice:  2000,
+		Currency:    "EUR",
+		Status:      models.ItemStatusActive,
+		AuctionType: models.AuctionTypeEnglish,
+		StartTime:   now.Add(-time.Second),
+		EndTime:     now.Add(time.Hour),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := client.CreateItem(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	bid, err := client.PlaceBid(ctx, item.ID, "bidder", 2500, 0, "", Idempotency{RequestID: "req-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bid.Success {
+		t.Fatalf("bid rejected: %+v", bid)
+	}
+
+	resetAt := now.Add(time.Minute)
+	reset, err := client.ResetPrice(ctx, item.ID, "admin", resetAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PriceReset{StartPrice: 2000, MinNextBid: 2000, ResetBy: "admin", Seq: bid.Seq + 1}
+	if *reset != want {
+		t.Fatalf("reset = %+v, want %+v", *reset, want)
+	}
+
+	entries, err := client.ReadOutbox(ctx, outboxShard(item.ID), "test", 10, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d outbox entries, want the bid and the reset", len(entries))
+	}
+	entry := entries[1]
+	if entry.Kind != OutboxKindReset || entry.ItemID != item.ID || entry.Currency != "EUR" {
+		t.Fatalf("second entry = %s of %s in %s, want the reset of %s in EUR", entry.Kind, entry.ItemID, entry.Currency, item.ID)
+	}
+	if !entry.Timestamp.Equal(resetAt.Truncate(time.Millisecond)) {
+		t.Errorf("timestamp = %v, want %v", entry.Timestamp, resetAt)
+	}
+	if *entry.Reset != want {
+		t.Errorf("queued reset = %+v, want %+v", *entry.Reset, want)
+	}
+
+	if _, err := client.ResetPrice(ctx, "missing", "admin", resetAt); err != ErrItemNotFound {
+		t.Errorf("reset of a missing item = %v, want ErrItemNotFound", err)
+	}
+}
@@ -0,0 +1,21 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+)
+
+// biddersKey returns the set of users with an accepted bid on an item, added to
+// by the bid script; the closing logic tells each of them the outcome
+func biddersKey(itemID string) string {
+	return fmt.Sprintf("item:%s:bidders", itemID)
+}
+
+// GetBidders returns the users with an accepted bid on an item
+func (c *Client) GetBidders(ctx context.Context, itemID string) ([]string, error) {
+	bidders, err := c.client.SMembers(ctx, biddersKey(itemID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bidders: %w", err)
+	}
+	return bidders, nil
+}
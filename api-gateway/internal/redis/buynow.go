@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// Buy-now errors returned by BuyNow
+var (
+	ErrAuctionNotOpen    = errors.New("auction is not open")
+	ErrBuyNowUnavailable = errors.New("buy-now is not available")
+)
+
+// buyNowLua wins an item at its buy-now price and closes it in one step
+// Like closeItemLua it runs exactly once per item, so a buy-now can't race with
+// a bid, the closer or another buyer; the close goes to the outbox the same way
+const buyNowLua = appendClosedLua + `
+	-- KEYS[1]: item:{itemID} (item metadata hash)
+	-- KEYS[2]: items:closing (sorted set of open items by end time)
+	-- KEYS[3]: item:{itemID}:current_bid
+	-- KEYS[4]: item:{itemID}:highest_bidder
+	-- KEYS[5]: item:{itemID}:proxy_max
+	-- KEYS[6]: outbox:{shard} (stream the close is relayed to JetStream from)
+	-- ARGV[1]: item ID
+	-- ARGV[2]: buyer user ID
+	-- ARGV[3]: current time (unix ms)
+	-- ARGV[4]: threshold in percent of the buy-now price; bidding at or past it removes buy-now
+	--
+	-- Returns {code, final_price, seq}
+	-- code: 1 bought, -1 not found, -2 closed, -3 auction not open, -4 buy-now not available
+
+	local function money(value)
+		return math.floor(tonumber(value) or 0)
+	end
+
+	local item = redis.call('HMGET', KEYS[1], 'status', 'start_time', 'end_time', 'buy_now_price')
+	if not item[1] then
+		return {-1, '0', 0}
+	end
+	if item[1] == 'closed' then
+		return {-2, '0', 0}
+	end
+	local now = tonumber(ARGV[3])
+	if now < tonumber(item[2]) or now >= tonumber(item[3]) then
+		return {-3, '0', 0}
+	end
+
+	local buy_now = money(item[4])
+	if buy_now <= 0 then
+		return {-4, '0', 0}
+	end
+	local current_bid = redis.call('GET', KEYS[3])
+	if current_bid then
+		local price = money(current_bid)
+		if price >= buy_now or price * 100 >= buy_now * tonumber(ARGV[4]) then
+			return {-4, '0', 0}
+		end
+	end
+
+	local final_price = string.format('%d', buy_now)
+	redis.call('SET', KEYS[3], final_price)
+	redis.call('SET', KEYS[4], ARGV[2])
+	redis.call('DEL', KEYS[5])
+	redis.call('HSET', KEYS[1], 'status', 'closed', 'winner_id', ARGV[2], 'updated_at', ARGV[3])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	local seq = append_closed(KEYS[1], KEYS[6], ARGV[1], ARGV[3], final_price, ARGV[2], 1, 1)
+	return {1, final_price, seq}
+`
+
+// BuyNow wins an item for userID at its buy-now price and closes the auction
+// thresholdPercent is the share of the buy-now price the current bid may reach
+// before buy-now is withdrawn (0 withdraws it with the first bid)
+// Returns ErrItemNotFound, ErrItemClosed, ErrAuctionNotOpen or ErrBuyNowUnavailable
+func (c *Client) BuyNow(ctx context.Context, itemID, userID string, thresholdPercent int, now time.Time) (*CloseResult, error) {
+	keys := []string{
+		itemKey(itemID),
+		closingSetKey,
+		fmt.Sprintf("item:%s:current_bid", itemID),
+		fmt.Sprintf("item:%s:highest_bidder", itemID),
+		proxyKey(itemID),
+		outboxKey(outboxShard(itemID)),
+	}
+
+	result, err := c.buyNowScript.Run(ctx, c.client, keys, itemID, userID, now.UnixMilli(), thresholdPercent).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to buy item: %w", err)
+	}
+	if len(result) != 3 {
+		return nil, fmt.Errorf("unexpected buy-now script result format")
+	}
+
+	switch result[0].(int64) {
+	case -1:
+		return nil, ErrItemNotFound
+	case -2:
+		return nil, ErrItemClosed
+	case -3:
+		return nil, ErrAuctionNotOpen
+	case -4:
+		return nil, ErrBuyNowUnavailable
+	}
+
+	finalPrice, err := strconv.ParseInt(result[1].(string), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse buy-now price of item %s: %w", itemID, err)
+	}
+
+	return &CloseResult{
+		FinalPrice: models.Money(finalPrice),
+		WinnerID:   userID,
+		ReserveMet: true,
+		BuyNow:     true,
+		Seq:        result[2].(int64),
+	}, nil
+}
+
+// BuyNowAvailable mirrors the checks of the buy-now script for an item read
+// with GetItem: the auction is open and bidding hasn't reached the threshold
+func BuyNowAvailable(item *models.Item, thresholdPercent int, now time.Time) bool {
+	buyNow := item.BuyNowPrice
+	if buyNow <= 0 || item.Status == models.ItemStatusClosed {
+		return false
+	}
+	if now.Before(item.StartTime) || !now.Before(item.EndTime) {
+		return false
+	}
+	if item.HighestBidderID == "" {
+		return true
+	}
+	price := item.CurrentBid
+	return price < buyNow && price*100 < buyNow*models.Money(thresholdPercent)
+}
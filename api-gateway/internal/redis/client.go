@@ -3,17 +3,335 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/aaronwang/bidding-app/shared/models"
 	"github.com/redis/go-redis/v9"
 )
 
+// bidLua is the atomic bid script: auction window, bidding rules, proxy
+// resolution and soft close are all evaluated in a single call
+const bidLua = appendClosedLua + `
+	-- KEYS[1]: item:{itemID}:current_bid (current highest bid amount in minor units)
+	-- KEYS[2]: item:{itemID}:highest_bidder (current highest bidder ID)
+	-- KEYS[3]: item:{itemID} (item metadata hash)
+	-- KEYS[4]: items:closing (sorted set of open items by end time)
+	-- KEYS[5]: item:{itemID}:proxy_max (hash of user ID -> secret maximum bid)
+	-- KEYS[6]: item:{itemID}:sealed_bids (hash of user ID -> "amount:time_ms")
+	-- ARGV[1]: bid amount (0 lets a proxy bid open at the minimum next bid)
+	-- ARGV[2]: bidder user ID
+	-- ARGV[3]: current time (unix ms)
+	-- ARGV[4]: item ID
+	-- ARGV[5]: maximum bid for proxy bidding (0 for a plain bid)
+	-- ARGV[6]: currency of the bid amounts ('' to accept the item's currency)
+	-- KEYS[7]: outbox:{shard} (stream of accepted bids for the relay to JetStream)
+	-- KEYS[8]: item:{itemID}:bidders (set of users with an accepted bid)
+	-- KEYS[9]: idempotency:{userID}:{key} (optional, list holding the stored result)
+	-- ARGV[7]: time to keep the stored result (ms)
+	-- ARGV[8]: request ID, stored with the result and the outbox entry
+	--
+	-- Returns {code, current_bid, end_time, extended, min_next_bid, reserve_met, seq, outbid_user,
+	--          step_user, step_amount, step_proxy, ...}
+	--      or {code, 0, end_time, 0, min_next_bid, 0, seq, '', bid_count} for sealed auctions
+	--      or {5, ..., step_user, step_amount, step_proxy, close_seq} for a won Dutch auction
+	--      or {7, item_id, request_id, <stored result>...} replaying an idempotency key
+	-- code: 1 accepted, 2 leader raised their maximum, 3 sealed bid accepted, 5 won a Dutch auction,
+	--       0 / 4 / 6 too low (open / sealed / Dutch), -5 proxy bid not supported,
+	--       -6 currency mismatch, -7 idempotency key used for another item, < 0 auction not open
+	-- Each step is one visible price change; proxy steps were placed from a stored maximum
+	-- seq is the item's sequence number, bumped once per step (once per sealed bid):
+	-- the steps of an accepted bid are numbered seq - #steps + 1 .. seq
+	-- outbid_user is the leader this bid displaced ('' if the leader didn't change)
+	-- All amounts are integers in minor units (cents) of the item's currency
+
+	local function money(value)
+		return math.floor(tonumber(value) or 0)
+	end
+
+	local function format_money(amount)
+		return string.format('%d', amount)
+	end
+
+	-- A retry with the idempotency key of an accepted bid gets the stored result
+	if KEYS[9] then
+		local stored = redis.call('LRANGE', KEYS[9], 0, -1)
+		if #stored > 0 then
+			if stored[1] ~= ARGV[4] then
+				return {-7, 0, 0, 0, 0, 0, 0, ''}
+			end
+			return {7, unpack(stored)}
+		end
+	end
+
+	-- accept records an accepted bid in the same script as the bid itself: bids that
+	-- changed the price (or sealed bids) are appended to the outbox, the bidder joins the
+	-- item's bidders and the result is stored under the idempotency key (as strings,
+	-- Lua numbers would lose precision)
+	local function accept(result, currency)
+		local encoded = {}
+		for _, value in ipairs(result) do
+			if type(value) == 'number' then
+				value = string.format('%d', value)
+			end
+			table.insert(encoded, value)
+		end
+		if result[1] ~= 2 then
+			redis.call('XADD', KEYS[7], '*',
+				'item_id', ARGV[4], 'request_id', ARGV[8], 'user_id', ARGV[2],
+				'amount', format_money(money(ARGV[1])), 'currency', currency, 'ts', ARGV[3],
+				'result', cjson.encode(encoded))
+		end
+		redis.call('SADD', KEYS[8], ARGV[2])
+		if KEYS[9] then
+			redis.call('RPUSH', KEYS[9], ARGV[4], ARGV[8], unpack(encoded))
+			redis.call('PEXPIRE', KEYS[9], ARGV[7])
+		end
+		return result
+	end
+
+	-- Get current bid (returns nil if doesn't exist)
+	local current_bid = redis.call('GET', KEYS[1])
+	local has_bids = current_bid ~= false
+
+	-- If no current bid, initialize with 0
+	current_bid = money(current_bid)
+
+	local item = redis.call('HMGET', KEYS[3], 'status', 'start_time', 'end_time',
+		'soft_close_window_ms', 'soft_close_extension_ms', 'max_end_time',
+		'start_price', 'min_increment', 'increment_tiers', 'reserve_price', 'auction_type',
+		'dutch_floor_price', 'dutch_decrement', 'dutch_interval_ms', 'currency', 'seq')
+	if not item[1] then
+		return {-1, current_bid, 0, 0, 0, 0, 0, ''}
+	end
+	local seq = money(item[16])
+
+	-- Minimum raise at a price: increment_tiers is encoded as
+	-- "from:increment,from:increment" in ascending order, min_increment is the fallback
+	local function increment_at(price)
+		local increment = money(item[8])
+		for from, step in string.gmatch(item[9] or '', '(%d+):(%d+)') do
+			if price >= money(from) then
+				increment = money(step)
+			end
+		end
+		if increment <= 0 then
+			increment = 1
+		end
+		return increment
+	end
+
+	-- Bidding rules: the first bid must reach the start price, later bids
+	-- must raise by the increment of the tier the current bid falls in
+	local price = current_bid
+	local min_next = money(item[7])
+	if has_bids then
+		min_next = price + increment_at(price)
+	elseif min_next <= 0 then
+		min_next = 1
+	end
+
+	local reserve = money(item[10])
+	local reserve_met = 0
+	if has_bids and price >= reserve then
+		reserve_met = 1
+	end
+
+	-- Check the auction is open: not closed, inside [start_time, end_time)
+	local end_time = tonumber(item[3])
+	if item[1] == 'closed' then
+		return {-2, current_bid, end_time, 0, min_next, reserve_met, seq, ''}
+	end
+	local now = tonumber(ARGV[3])
+	if now < tonumber(item[2]) then
+		return {-3, current_bid, end_time, 0, min_next, reserve_met, seq, ''}
+	end
+	if now >= end_time then
+		return {-4, current_bid, end_time, 0, min_next, reserve_met, seq, ''}
+	end
+	if ARGV[6] ~= '' and ARGV[6] ~= (item[15] or 'USD') then
+		return {-6, current_bid, end_time, 0, min_next, reserve_met, seq, ''}
+	end
+
+	-- Sealed auctions: bids stay hidden until close, a bidder may only raise their own bid
+	-- (the closing script picks the winner and clearing price)
+	if item[11] == 'sealed_first_price' or item[11] == 'sealed_second_price' then
+		if tonumber(ARGV[5]) > 0 then
+			return {-5, 0, end_time, 0, min_next, 0, seq, ''}
+		end
+		local amount = money(ARGV[1])
+		local own = money(string.match(redis.call('HGET', KEYS[6], ARGV[2]) or '', '^(%d+)'))
+		if amount < min_next or amount <= own then
+			return {4, 0, end_time, 0, math.max(min_next, own + 1), 0, seq, ''}
+		end
+		redis.call('HSET', KEYS[6], ARGV[2], amount .. ':' .. ARGV[3])
+		local bid_count = redis.call('HINCRBY', KEYS[3], 'bid_count', 1)
+		seq = redis.call('HINCRBY', KEYS[3], 'seq', 1)
+		return accept({3, 0, end_time, 0, min_next, 0, seq, '', bid_count}, item[15] or 'USD')
+	end
+
+	-- Dutch auctions: the first bid at or above the clock price wins at the clock
+	-- price and closes the auction (the clock is the same as models.DutchClockPrice)
+	if item[11] == 'dutch' then
+		if tonumber(ARGV[5]) > 0 then
+			return {-5, current_bid, end_time, 0, min_next, 0, seq, ''}
+		end
+		local clock = money(item[7])
+		local interval = tonumber(item[14]) or 0
+		if interval > 0 then
+			local drops = math.floor((now - tonumber(item[2])) / interval)
+			clock = clock - drops * money(item[13])
+		end
+		clock = math.max(clock, money(item[12]))
+		if money(ARGV[1]) < clock then
+			return {6, current_bid, end_time, 0, clock, 0, seq, ''}
+		end
+		redis.call('SET', KEYS[1], format_money(clock))
+		redis.call('SET', KEYS[2], ARGV[2])
+		redis.call('HSET', KEYS[3], 'status', 'closed', 'winner_id', ARGV[2], 'updated_at', ARGV[3])
+		redis.call('HINCRBY', KEYS[3], 'bid_count', 1)
+		seq = redis.call('HINCRBY', KEYS[3], 'seq', 1)
+		redis.call('ZREM', KEYS[4], ARGV[4])
+		-- The close follows the winning bid in the outbox and takes the next sequence number
+		local result = accept({5, current_bid, end_time, 0, clock, 1, seq, '', ARGV[2], clock, 0, seq + 1}, item[15] or 'USD')
+		append_closed(KEYS[3], KEYS[7], ARGV[4], ARGV[3], format_money(clock), ARGV[2], 1, 0)
+		return result
+	end
+
+	local bidder = ARGV[2]
+	local opening = money(ARGV[1])
+	local max_bid = money(ARGV[5])
+	local is_proxy = max_bid > 0
+	if not is_proxy then
+		max_bid = opening
+	end
+	if opening < min_next then
+		opening = min_next
+	end
+
+	-- Compare: the bid (or maximum) must reach the minimum next bid
+	if max_bid < min_next then
+		return {0, current_bid, end_time, 0, min_next, reserve_met, seq, ''}
+	end
+
+	-- The leader raising their own maximum doesn't change the visible price
+	local leader = redis.call('GET', KEYS[2]) or ''
+	if has_bids and leader == bidder and is_proxy then
+		local current_max = money(redis.call('HGET', KEYS[5], bidder))
+		if max_bid > current_max then
+			redis.call('HSET', KEYS[5], bidder, format_money(max_bid))
+		end
+		return accept({2, current_bid, end_time, 0, min_next, reserve_met, seq, ''}, item[15] or 'USD')
+	end
+
+	-- The leader's maximum is never below the visible price
+	local leader_max = price
+	if has_bids and leader ~= bidder then
+		local stored = redis.call('HGET', KEYS[5], leader)
+		if stored and money(stored) > leader_max then
+			leader_max = money(stored)
+		end
+	end
+
+	-- Resolve proxies: every visible price change becomes a step
+	local bidder_proxy = 0
+	if is_proxy then
+		bidder_proxy = 1
+	end
+	local steps = {}
+	local new_leader = bidder
+	local final_price
+	if has_bids and leader ~= bidder and leader_max >= max_bid then
+		-- The leader's maximum covers this bid, their proxy answers
+		-- (on a tie the earlier bidder keeps the lead at that amount)
+		local answer = math.min(leader_max, max_bid + increment_at(max_bid))
+		if answer > max_bid then
+			table.insert(steps, {bidder, max_bid, bidder_proxy})
+		end
+		table.insert(steps, {leader, answer, 1})
+		new_leader = leader
+		final_price = answer
+	else
+		if has_bids and leader ~= bidder and leader_max > price then
+			-- The displaced leader's proxy bids up to its maximum first
+			table.insert(steps, {leader, leader_max, 1})
+		end
+		local visible = opening
+		if is_proxy and has_bids and leader ~= bidder then
+			visible = math.max(opening, math.min(max_bid, leader_max + increment_at(leader_max)))
+		end
+		table.insert(steps, {bidder, visible, bidder_proxy})
+		if has_bids and leader ~= bidder then
+			redis.call('HDEL', KEYS[5], leader)
+		end
+		final_price = visible
+	end
+
+	-- Set new highest bid and bidder
+	redis.call('SET', KEYS[1], format_money(final_price))
+	redis.call('SET', KEYS[2], new_leader)
+	redis.call('HINCRBY', KEYS[3], 'bid_count', 1)
+	seq = redis.call('HINCRBY', KEYS[3], 'seq', #steps)
+	if is_proxy and new_leader == bidder then
+		redis.call('HSET', KEYS[5], bidder, format_money(max_bid))
+	end
+
+	-- Soft close: a bid inside the window extends the end time (up to max_end_time)
+	local extended = 0
+	local window = tonumber(item[4]) or 0
+	if window > 0 and end_time - now < window then
+		local new_end = end_time + (tonumber(item[5]) or 0)
+		local max_end = tonumber(item[6]) or 0
+		if max_end > 0 and new_end > max_end then
+			new_end = max_end
+		end
+		if new_end > end_time then
+			end_time = new_end
+			extended = 1
+			redis.call('HSET', KEYS[3], 'end_time', end_time)
+			redis.call('ZADD', KEYS[4], end_time, ARGV[4])
+		end
+	end
+
+	-- Minimum next bid and reserve status after this bid
+	min_next = final_price + increment_at(final_price)
+	if final_price >= reserve then
+		reserve_met = 1
+	end
+
+	-- Return success with previous bid, (possibly extended) end time, sequence number,
+	-- displaced leader and the steps
+	local outbid = ''
+	if has_bids and leader ~= new_leader then
+		outbid = leader
+	end
+	local result = {1, current_bid, end_time, extended, min_next, reserve_met, seq, outbid}
+	for _, step in ipairs(steps) do
+		table.insert(result, step[1])
+		table.insert(result, step[2])
+		table.insert(result, step[3])
+	end
+	return accept(result, item[15] or 'USD')
+`
+
 // Client wraps the Redis client with bidding-specific operations
 type Client struct {
 	client *redis.Client
 	// Lua script for atomic compare-and-set bid operation
 	bidScript *redis.Script
+	// Lua scripts for the item lifecycle (see items.go)
+	createItemScript *redis.Script
+	updateItemScript *redis.Script
+	closeItemScript  *redis.Script
+	buyNowScript     *redis.Script
+	// Lua script for admin price resets (see admin.go)
+	resetPriceScript *redis.Script
+	// Lua script for the bid rate limiter (see ratelimit.go)
+	takeTokensScript *redis.Script
+	// Lua script for the outbox dead letters (see outbox.go)
+	deadLetterScript *redis.Script
 	// Strategy: "lua" or "optimistic"
 	strategy string
 }
@@ -50,111 +368,257 @@ func NewClient(addr, password string, db int, strategy string) (*Client, error)
 
 	// Define Lua script for atomic bid operation
 	// This script runs atomically on Redis server - no race conditions!
-	bidScript := redis.NewScript(`
-		-- KEYS[1]: item:{itemID}:current_bid (current highest bid amount)
-		-- KEYS[2]: item:{itemID}:highest_bidder (current highest bidder ID)
-		-- ARGV[1]: new bid amount
-		-- ARGV[2]: bidder user ID
-
-		-- Get current bid (returns nil if doesn't exist)
-		local current_bid = redis.call('GET', KEYS[1])
-
-		-- If no current bid, initialize with 0
-		if not current_bid then
-			current_bid = 0
-		else
-			current_bid = tonumber(current_bid)
-		end
-
-		local new_bid = tonumber(ARGV[1])
-
-		-- Compare: new bid must be higher than current
-		if new_bid > current_bid then
-			-- Set new highest bid
-			redis.call('SET', KEYS[1], new_bid)
-			-- Set new highest bidder
-			redis.call('SET', KEYS[2], ARGV[2])
-			-- Return success with previous bid
-			return {1, current_bid}
-		else
-			-- Bid too low, return failure with current bid
-			return {0, current_bid}
-		end
-	`)
+	// The auction window is checked in the same script, so a bid can never
+	// slip in after the item was closed or its end time has passed, and the
+	// soft-close extension is applied together with the price update
+	bidScript := redis.NewScript(bidLua)
 
 	fmt.Printf("[REDIS] Initialized with strategy: %s\n", strategy)
 	return &Client{
-		client:    rdb,
-		bidScript: bidScript,
-		strategy:  strategy,
+		client:           rdb,
+		bidScript:        bidScript,
+		createItemScript: redis.NewScript(createItemLua),
+		updateItemScript: redis.NewScript(updateItemLua),
+		closeItemScript:  redis.NewScript(closeItemLua),
+		buyNowScript:     redis.NewScript(buyNowLua),
+		resetPriceScript: redis.NewScript(resetPriceLua),
+		takeTokensScript: redis.NewScript(takeTokensLua),
+		deadLetterScript: redis.NewScript(deadLetterLua),
+		strategy:         strategy,
 	}, nil
 }
 
 // BidResult represents the result of a bid operation
 type BidResult struct {
-	Success     bool
-	PreviousBid float64
-	CurrentBid  float64
+	Success       bool
+	PreviousBid   models.Money
+	CurrentBid    models.Money
+	HighestBidder string       // Leader after this bid (may be a proxy that outbid the caller)
+	Steps         []BidStep    // Visible price changes, in order
+	MaxRaised     bool         // The leader raised their own maximum, the price didn't change
+	Sealed        bool         // Bid in a sealed auction: only Success, MinNextBid and BidCount are set
+	BidCount      int64        // Bids accepted so far (sealed auctions only)
+	Dutch         bool         // Bid in a Dutch auction: on success it won and closed the auction
+	CloseSeq      int64        // Won Dutch auctions: item sequence number of the close, after Seq
+	Reason        string       // Rejection reason (models.BidReject*), empty on success
+	EndTime       time.Time    // Auction end time after this bid
+	Extended      bool         // True if this bid extended the end time (soft close)
+	MinNextBid    models.Money // Lowest bid accepted after this one
+	ReserveMet    bool         // True if the highest bid reached the reserve price
+	Seq           int64        // Item sequence number after this bid (of its last step)
+	OutbidUserID  string       // Leader displaced by this bid, empty if the leader didn't change
+	AcceptedAt    time.Time    // Time the bid was evaluated, the timestamp of its events
+	RequestID     string       // Request ID of the bid, the original one when Replayed
+	Replayed      bool         // Stored result of an earlier request with the same idempotency key
+}
+
+// bidRejectReasons maps the bid script result codes to rejection reasons
+var bidRejectReasons = map[int64]string{
+	0:  models.BidRejectTooLow,
+	-1: models.BidRejectItemNotFound,
+	-2: models.BidRejectAuctionClosed,
+	-3: models.BidRejectNotStarted,
+	-4: models.BidRejectEnded,
+	-5: models.BidRejectProxyUnsupported,
+	-6: models.BidRejectCurrency,
+	4:  models.BidRejectTooLow,
+	6:  models.BidRejectTooLow,
+}
+
+// bidRejectedError aborts an optimistic transaction for a business rule rejection
+// (as opposed to a WATCH conflict, which is retried)
+type bidRejectedError struct {
+	sealed     bool
+	dutch      bool
+	reason     string
+	currentBid models.Money
+	minNextBid models.Money
+	reserveMet bool
+	seq        int64
+}
+
+func (e *bidRejectedError) Error() string {
+	return fmt.Sprintf("bid rejected: %s (current bid %s)", e.reason, e.currentBid)
 }
 
 // PlaceBid atomically attempts to place a bid on an item
+// maxAmount > 0 makes it a proxy bid: the maximum is stored secretly and the
+// system bids on the user's behalf up to it (amount may then be 0)
+// currency is the currency of the amounts; empty accepts the item's currency,
+// anything else must match it
+// With an idempotency key the result of an accepted bid is stored together with
+// the bid, and a retry with the same key gets it back (Replayed) instead of bidding again
 // Uses the strategy specified during client initialization (lua or optimistic)
 // Returns BidResult indicating success/failure and relevant bid amounts
-func (c *Client) PlaceBid(ctx context.Context, itemID, userID string, amount float64) (*BidResult, error) {
+func (c *Client) PlaceBid(ctx context.Context, itemID, userID string, amount, maxAmount models.Money, currency string, idem Idempotency) (*BidResult, error) {
 	if c.strategy == "optimistic" {
-		return c.placeBidOptimistic(ctx, itemID, userID, amount)
+		return c.placeBidOptimistic(ctx, itemID, userID, amount, maxAmount, currency, idem)
 	}
-	return c.placeBidLua(ctx, itemID, userID, amount)
+	return c.placeBidLua(ctx, itemID, userID, amount, maxAmount, currency, idem)
 }
 
 // placeBidLua uses Lua script for atomic bid operation
-func (c *Client) placeBidLua(ctx context.Context, itemID, userID string, amount float64) (*BidResult, error) {
+func (c *Client) placeBidLua(ctx context.Context, itemID, userID string, amount, maxAmount models.Money, currency string, idem Idempotency) (*BidResult, error) {
 	keys := []string{
 		fmt.Sprintf("item:%s:current_bid", itemID),
 		fmt.Sprintf("item:%s:highest_bidder", itemID),
+		itemKey(itemID),
+		closingSetKey,
+		proxyKey(itemID),
+		sealedBidsKey(itemID),
+		outboxKey(outboxShard(itemID)),
+		biddersKey(itemID),
+	}
+	if idem.Key != "" {
+		keys = append(keys, idempotencyKey(userID, idem.Key))
 	}
 
 	// Execute Lua script atomically
-	result, err := c.bidScript.Run(ctx, c.client, keys, amount, userID).Result()
+	now := time.Now().UnixMilli()
+	result, err := c.bidScript.Run(ctx, c.client, keys, amount, userID, now, itemID, maxAmount, currency,
+		idempotencyTTL.Milliseconds(), idem.RequestID).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute bid script: %w", err)
 	}
 
-	// Parse result
-	// Result is [success_flag, previous_bid]
 	resultArray, ok := result.([]interface{})
-	if !ok || len(resultArray) != 2 {
+	if !ok || len(resultArray) < 1 {
 		return nil, fmt.Errorf("unexpected script result format")
 	}
+	switch resultArray[0].(int64) {
+	case -7:
+		return nil, ErrIdempotencyKeyReused
+	case 7:
+		// [7, item_id, request_id, stored result...]
+		if len(resultArray) < 3 {
+			return nil, fmt.Errorf("unexpected script result format")
+		}
+		bidResult, err := parseBidResult(userID, resultArray[3:])
+		if err != nil {
+			return nil, err
+		}
+		bidResult.RequestID = resultArray[2].(string)
+		bidResult.Replayed = true
+		return bidResult, nil
+	}
 
-	success := resultArray[0].(int64) == 1
-	previousBid := float64(resultArray[1].(int64))
+	bidResult, err := parseBidResult(userID, resultArray)
+	if err != nil {
+		return nil, err
+	}
+	bidResult.RequestID = idem.RequestID
+	bidResult.AcceptedAt = time.UnixMilli(now).UTC()
+	return bidResult, nil
+}
+
+// parseBidResult parses a result of the bid script for a bid of userID
+// Result is [status_code, previous_bid, end_time, extended, min_next_bid, reserve_met, seq, outbid_user, steps...]
+// or [status_code, 0, end_time, 0, min_next_bid, 0, seq, "", bid_count] for sealed auctions,
+// with the close's sequence number after the steps of a won Dutch auction
+// All amounts are integers in minor units; stored results replayed for an
+// idempotency key hold them as strings
+func parseBidResult(userID string, resultArray []interface{}) (*BidResult, error) {
+	if len(resultArray) < 8 {
+		return nil, fmt.Errorf("unexpected script result format")
+	}
+	values := make([]int64, len(resultArray))
+	for i, value := range resultArray {
+		switch v := value.(type) {
+		case int64:
+			values[i] = v
+		case string:
+			values[i], _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
 
-	currentBid := previousBid
-	if success {
-		currentBid = amount
+	code := values[0]
+	sealed := code == 3 || code == 4
+	var closeSeq int64
+	if code == 5 && (len(resultArray)-8)%3 == 1 {
+		closeSeq = values[len(values)-1]
+		resultArray = resultArray[:len(resultArray)-1]
+	}
+	if !sealed && (len(resultArray)-8)%3 != 0 {
+		return nil, fmt.Errorf("unexpected script result format")
 	}
+	previousBid := models.Money(values[1])
 
-	return &BidResult{
-		Success:     success,
+	bidResult := &BidResult{
+		Success:     code == 1 || code == 2 || code == 3 || code == 5,
 		PreviousBid: previousBid,
-		CurrentBid:  currentBid,
-	}, nil
+		CurrentBid:  previousBid,
+		MaxRaised:   code == 2,
+		Sealed:      sealed,
+		Dutch:       code == 5 || code == 6,
+		Reason:      bidRejectReasons[code],
+		EndTime:     time.UnixMilli(values[2]).UTC(),
+		Extended:    values[3] == 1,
+		MinNextBid:  models.Money(values[4]),
+		ReserveMet:  values[5] == 1,
+		Seq:         values[6],
+		CloseSeq:    closeSeq,
+	}
+	bidResult.OutbidUserID, _ = resultArray[7].(string)
+	if code == 2 {
+		bidResult.HighestBidder = userID
+	}
+	if sealed {
+		if len(values) == 9 {
+			bidResult.BidCount = values[8]
+		}
+		return bidResult, nil
+	}
+
+	for i := 8; i < len(resultArray); i += 3 {
+		stepUser, ok := resultArray[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected script result format")
+		}
+		bidResult.Steps = append(bidResult.Steps, BidStep{
+			UserID: stepUser,
+			Amount: models.Money(values[i+1]),
+			Proxy:  values[i+2] == 1,
+		})
+	}
+	if n := len(bidResult.Steps); n > 0 {
+		bidResult.CurrentBid = bidResult.Steps[n-1].Amount
+		bidResult.HighestBidder = bidResult.Steps[n-1].UserID
+	}
+
+	return bidResult, nil
 }
 
 // placeBidOptimistic uses optimistic locking (WATCH/MULTI/EXEC) for bid operation
-func (c *Client) placeBidOptimistic(ctx context.Context, itemID, userID string, amount float64) (*BidResult, error) {
+func (c *Client) placeBidOptimistic(ctx context.Context, itemID, userID string, amount, maxAmount models.Money, currency string, idem Idempotency) (*BidResult, error) {
 	bidKey := fmt.Sprintf("item:%s:current_bid", itemID)
 	bidderKey := fmt.Sprintf("item:%s:highest_bidder", itemID)
+	metaKey := itemKey(itemID)
+	maxKey := proxyKey(itemID)
+	sealedKey := sealedBidsKey(itemID)
+	watched := []string{bidKey, bidderKey, metaKey, maxKey, sealedKey}
+	if idem.Key != "" {
+		watched = append(watched, idempotencyKey(userID, idem.Key))
+	}
 
 	maxRetries := 10
 	var lastErr error
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		var bidResult *BidResult
+
 		err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+			// A retry of an accepted bid gets the stored result
+			if idem.Key != "" {
+				stored, err := getStoredBid(ctx, tx, itemID, userID, idem)
+				if err != nil || stored != nil {
+					bidResult = stored
+					return err
+				}
+			}
+
 			// GET current bid inside WATCH transaction
 			currentBidStr, err := tx.Get(ctx, bidKey).Result()
-			var currentBid float64
+			var currentBid models.Money
 
 			if err == redis.Nil {
 				// No current bid, start from 0
@@ -162,46 +626,196 @@ func (c *Client) placeBidOptimistic(ctx context.Context, itemID, userID string,
 			} else if err != nil {
 				return fmt.Errorf("failed to get current bid: %w", err)
 			} else {
-				// Parse current bid
-				if _, err := fmt.Sscanf(currentBidStr, "%f", &currentBid); err != nil {
+				// Parse current bid (integer minor units)
+				cents, err := strconv.ParseInt(currentBidStr, 10, 64)
+				if err != nil {
 					return fmt.Errorf("failed to parse current bid: %w", err)
 				}
+				currentBid = models.Money(cents)
+			}
+
+			// Check the auction is open (the item hash is watched too, so a
+			// concurrent close aborts this transaction)
+			fields, err := tx.HGetAll(ctx, metaKey).Result()
+			if err != nil {
+				return fmt.Errorf("failed to get item: %w", err)
+			}
+			hasBids := currentBidStr != ""
+			minNext := minNextBid(fields, currentBid, hasBids)
+			now := time.Now().UnixMilli()
+			reason := auctionRejectReason(fields, now)
+			if reason == "" && currency != "" && currency != itemCurrency(fields) {
+				reason = models.BidRejectCurrency
+			}
+			if reason != "" {
+				return &bidRejectedError{
+					reason:     reason,
+					currentBid: currentBid,
+					minNextBid: minNext,
+					reserveMet: reserveMet(fields, currentBid, hasBids),
+					seq:        itemSeq(fields),
+				}
+			}
+
+			// Sealed auctions: bids stay hidden until close
+			if models.IsSealed(fields["auction_type"]) {
+				bidResult, err = placeSealedBid(ctx, tx, fields, itemID, userID, amount, maxAmount, now, idem)
+				return err
+			}
+
+			// Dutch auctions: the first bid at or above the clock price wins
+			if fields["auction_type"] == models.AuctionTypeDutch {
+				bidResult, err = placeDutchBid(ctx, tx, fields, itemID, userID, amount, maxAmount, currentBid, now, idem)
+				return err
 			}
 
-			// Check if new bid is higher
-			if amount <= currentBid {
+			// Check the bid (or maximum) reaches the start price / minimum increment
+			isProxy := maxAmount > 0
+			maxBid := maxAmount
+			if !isProxy {
+				maxBid = amount
+			}
+			if maxBid < minNext {
 				// Bid too low - return special error to distinguish from WATCH conflict
-				return fmt.Errorf("BID_TOO_LOW:%.2f", currentBid)
+				return &bidRejectedError{
+					reason:     models.BidRejectTooLow,
+					currentBid: currentBid,
+					minNextBid: minNext,
+					reserveMet: reserveMet(fields, currentBid, hasBids),
+					seq:        itemSeq(fields),
+				}
+			}
+
+			leader, err := tx.Get(ctx, bidderKey).Result()
+			if err != nil && err != redis.Nil {
+				return fmt.Errorf("failed to get highest bidder: %w", err)
+			}
+
+			// The leader raising their own maximum doesn't change the visible price
+			if hasBids && leader == userID && isProxy {
+				endTime, _ := strconv.ParseInt(fields["end_time"], 10, 64)
+				currentMax, err := tx.HGet(ctx, maxKey, userID).Int64()
+				if err != nil && err != redis.Nil {
+					return fmt.Errorf("failed to get maximum bid: %w", err)
+				}
+				bidResult = &BidResult{
+					Success:       true,
+					PreviousBid:   currentBid,
+					CurrentBid:    currentBid,
+					HighestBidder: userID,
+					MaxRaised:     true,
+					EndTime:       time.UnixMilli(endTime).UTC(),
+					MinNextBid:    minNext,
+					ReserveMet:    reserveMet(fields, currentBid, hasBids),
+					Seq:           itemSeq(fields),
+					RequestID:     idem.RequestID,
+					AcceptedAt:    time.UnixMilli(now).UTC(),
+				}
+				_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					if maxAmount > models.Money(currentMax) {
+						pipe.HSet(ctx, maxKey, userID, maxAmount)
+					}
+					recordBid(ctx, pipe, itemID, userID, amount, itemCurrency(fields), now, idem, bidResult)
+					return nil
+				})
+				return err
+			}
+
+			// The leader's maximum is never below the visible price
+			leaderMax := currentBid
+			if hasBids && leader != userID {
+				stored, err := tx.HGet(ctx, maxKey, leader).Int64()
+				if err != nil && err != redis.Nil {
+					return fmt.Errorf("failed to get maximum bid: %w", err)
+				}
+				if models.Money(stored) > leaderMax {
+					leaderMax = models.Money(stored)
+				}
 			}
 
-			// MULTI/EXEC: atomic update if watched key hasn't changed
+			// Resolve proxies: every visible price change becomes a step
+			steps := resolveBid(fields, proxyBid{
+				price:     currentBid,
+				minNext:   minNext,
+				hasBids:   hasBids,
+				leader:    leader,
+				leaderMax: leaderMax,
+				bidder:    userID,
+				opening:   amount,
+				maxBid:    maxBid,
+				isProxy:   isProxy,
+			})
+			final := steps[len(steps)-1]
+
+			// Soft close: a bid inside the window extends the end time
+			endTime, extended := softCloseEndTime(fields, now)
+
+			var outbidUserID string
+			if hasBids && leader != final.UserID {
+				outbidUserID = leader
+			}
+
+			bidResult = &BidResult{
+				Success:       true,
+				PreviousBid:   currentBid,
+				CurrentBid:    final.Amount,
+				HighestBidder: final.UserID,
+				Steps:         steps,
+				EndTime:       time.UnixMilli(endTime).UTC(),
+				Extended:      extended,
+				MinNextBid:    minNextBid(fields, final.Amount, true),
+				ReserveMet:    reserveMet(fields, final.Amount, true),
+				Seq:           itemSeq(fields) + int64(len(steps)),
+				OutbidUserID:  outbidUserID,
+				RequestID:     idem.RequestID,
+				AcceptedAt:    time.UnixMilli(now).UTC(),
+			}
+
+			// MULTI/EXEC: atomic update if watched keys haven't changed
 			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-				pipe.Set(ctx, bidKey, fmt.Sprintf("%.2f", amount), 0)
-				pipe.Set(ctx, bidderKey, userID, 0)
+				pipe.Set(ctx, bidKey, final.Amount, 0)
+				pipe.Set(ctx, bidderKey, final.UserID, 0)
+				pipe.HIncrBy(ctx, metaKey, "bid_count", 1)
+				pipe.HIncrBy(ctx, metaKey, "seq", int64(len(steps)))
+				if hasBids && leader != userID && final.UserID == userID {
+					pipe.HDel(ctx, maxKey, leader)
+				}
+				if isProxy && final.UserID == userID {
+					pipe.HSet(ctx, maxKey, userID, maxAmount)
+				}
+				if extended {
+					pipe.HSet(ctx, metaKey, "end_time", endTime)
+					pipe.ZAdd(ctx, closingSetKey, redis.Z{Score: float64(endTime), Member: itemID})
+				}
+				recordBid(ctx, pipe, itemID, userID, amount, itemCurrency(fields), now, idem, bidResult)
 				return nil
 			})
-
 			return err
-		}, bidKey)
+		}, watched...)
 
 		// Analyze the result
 		if err == nil {
 			// Success! Transaction completed without conflicts
-			return &BidResult{
-				Success:     true,
-				PreviousBid: 0, // We don't track previous in optimistic mode
-				CurrentBid:  amount,
-			}, nil
+			return bidResult, nil
 		}
 
-		// Check if it's a business logic rejection (bid too low)
-		if len(err.Error()) > 12 && err.Error()[:12] == "BID_TOO_LOW:" {
-			var currentBid float64
-			fmt.Sscanf(err.Error()[12:], "%f", &currentBid)
+		if errors.Is(err, ErrIdempotencyKeyReused) {
+			return nil, err
+		}
+
+		// Check if it's a business logic rejection (bid too low, auction not open)
+		var rejected *bidRejectedError
+		if errors.As(err, &rejected) {
 			return &BidResult{
 				Success:     false,
-				PreviousBid: currentBid,
-				CurrentBid:  currentBid,
+				PreviousBid: rejected.currentBid,
+				CurrentBid:  rejected.currentBid,
+				Sealed:      rejected.sealed,
+				Dutch:       rejected.dutch,
+				Reason:      rejected.reason,
+				MinNextBid:  rejected.minNextBid,
+				ReserveMet:  rejected.reserveMet,
+				Seq:         rejected.seq,
 			}, nil
 		}
 
@@ -220,33 +834,6 @@ func (c *Client) placeBidOptimistic(ctx context.Context, itemID, userID string,
 	return nil, fmt.Errorf("max retries exceeded (%d attempts), last error: %w", maxRetries, lastErr)
 }
 
-// GetItemBid retrieves the current highest bid for an item
-func (c *Client) GetItemBid(ctx context.Context, itemID string) (float64, string, error) {
-	pipe := c.client.Pipeline()
-
-	bidCmd := pipe.Get(ctx, fmt.Sprintf("item:%s:current_bid", itemID))
-	bidderCmd := pipe.Get(ctx, fmt.Sprintf("item:%s:highest_bidder", itemID))
-
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
-		return 0, "", fmt.Errorf("failed to get item bid: %w", err)
-	}
-
-	var bid float64
-	if bidCmd.Err() == nil {
-		if err := bidCmd.Scan(&bid); err != nil {
-			bid = 0
-		}
-	}
-
-	var bidder string
-	if bidderCmd.Err() == nil {
-		bidder = bidderCmd.Val()
-	}
-
-	return bid, bidder, nil
-}
-
 // PublishBidEvent publishes a bid event to Redis Pub/Sub
 // This will be picked up by the broadcast service for real-time WebSocket updates
 func (c *Client) PublishBidEvent(ctx context.Context, itemID string, event interface{}) error {
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// placeDutchBid mirrors the Dutch branch of the bid script for the optimistic
+// strategy. It runs inside the WATCH transaction of placeBidOptimistic, after the
+// auction window was checked; rejections are returned as *bidRejectedError
+// Like the script it queues the close in the outbox right after the winning bid
+func placeDutchBid(ctx context.Context, tx *redis.Tx, fields map[string]string, itemID, userID string, amount, maxAmount, currentBid models.Money, now int64, idem Idempotency) (*BidResult, error) {
+	clock := dutchClockPrice(fields, now)
+	if maxAmount > 0 {
+		return nil, &bidRejectedError{dutch: true, reason: models.BidRejectProxyUnsupported, currentBid: currentBid, minNextBid: clock, seq: itemSeq(fields)}
+	}
+	if amount < clock {
+		return nil, &bidRejectedError{dutch: true, reason: models.BidRejectTooLow, currentBid: currentBid, minNextBid: clock, seq: itemSeq(fields)}
+	}
+
+	endTime, _ := strconv.ParseInt(fields["end_time"], 10, 64)
+	result := &BidResult{
+		Success:       true,
+		Dutch:         true,
+		PreviousBid:   currentBid,
+		CurrentBid:    clock,
+		HighestBidder: userID,
+		Steps:         []BidStep{{UserID: userID, Amount: clock}},
+		EndTime:       time.UnixMilli(endTime).UTC(),
+		MinNextBid:    clock,
+		ReserveMet:    true,
+		Seq:           itemSeq(fields) + 1,
+		CloseSeq:      itemSeq(fields) + 2,
+		RequestID:     idem.RequestID,
+		AcceptedAt:    time.UnixMilli(now).UTC(),
+	}
+
+	// First acceptor wins: take the item at the clock price and close the auction
+	_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fmt.Sprintf("item:%s:current_bid", itemID), clock, 0)
+		pipe.Set(ctx, fmt.Sprintf("item:%s:highest_bidder", itemID), userID, 0)
+		pipe.HSet(ctx, itemKey(itemID), "status", models.ItemStatusClosed, "winner_id", userID, "updated_at", now)
+		pipe.HIncrBy(ctx, itemKey(itemID), "bid_count", 1)
+		pipe.HIncrBy(ctx, itemKey(itemID), "seq", 2) // The bid and the close
+		pipe.ZRem(ctx, closingSetKey, itemID)
+		recordBid(ctx, pipe, itemID, userID, amount, itemCurrency(fields), now, idem, result)
+		appendClosed(ctx, pipe, itemID, fields, now, &CloseResult{
+			FinalPrice: clock,
+			WinnerID:   userID,
+			ReserveMet: true,
+			Seq:        result.CloseSeq,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// dutchClockPrice returns the clock price of the Dutch auction stored in the
+// item metadata hash at now (unix ms)
+func dutchClockPrice(fields map[string]string, now int64) models.Money {
+	startPrice := parseMoney(fields["start_price"])
+	startTime, _ := strconv.ParseInt(fields["start_time"], 10, 64)
+	return models.DutchClockPrice(startPrice, time.UnixMilli(startTime), parseDutchRule(fields), time.UnixMilli(now))
+}
+
+// dutchFields returns the item hash fields storing its Dutch clock
+func dutchFields(item *models.Item) []interface{} {
+	var floor, decrement models.Money
+	var interval int64
+	if rule := item.Dutch; rule != nil {
+		floor = rule.FloorPrice
+		decrement = rule.DecrementAmount
+		interval = int64(rule.DecrementIntervalSeconds) * 1000
+	}
+	return []interface{}{
+		"dutch_floor_price", floor,
+		"dutch_decrement", decrement,
+		"dutch_interval_ms", interval,
+	}
+}
+
+// parseDutchRule decodes the Dutch clock of the item metadata hash
+func parseDutchRule(fields map[string]string) *models.DutchRule {
+	rule := &models.DutchRule{}
+	rule.FloorPrice = parseMoney(fields["dutch_floor_price"])
+	rule.DecrementAmount = parseMoney(fields["dutch_decrement"])
+	interval, _ := strconv.ParseInt(fields["dutch_interval_ms"], 10, 64)
+	rule.DecrementIntervalSeconds = int(interval / 1000)
+	return rule
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestClient returns a client on an in-memory Redis with the outbox prepared
+func newTestClient(t *testing.T, strategy string) *Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client, err := NewClient(server.Addr(), "", 0, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.client.Close() })
+	if err := client.EnsureOutbox(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// TestDutchWinAppendsClose checks that winning a Dutch auction queues the close
+// in the outbox right after the winning bid, with the next sequence number
+func TestDutchWinAppendsClose(t *testing.T) {
+	for _, strategy := range []string{"lua", "optimistic"} {
+		t.Run(strategy, func(t *testing.T) {
+			ctx := context.Background()
+			client := newTestClient(t, strategy)
+
+			now := time.Now()
+			item := &models.Item{
+				ID:          "dutch-1",
+				Name:        "Clock",
+				Description: "A Dutch auction",
+				StartPrice:  10000,
+				Currency:    "EUR",
+				Status:      models.ItemStatusActive,
+				AuctionType: models.AuctionTypeDutch,
+				StartTime:   now.Add(-time.Second),
+				EndTime:     now.Add(time.Hour),
+				Dutch:       &models.DutchRule{FloorPrice: 5000, DecrementAmount: 100, DecrementIntervalSeconds: 60},
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := client.CreateItem(ctx, item); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := client.PlaceBid(ctx, item.ID, "buyer", 10000, 0, "", Idempotency{RequestID: "req-1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Success || !result.Dutch {
+				t.Fatalf("bid at the clock price: got %+v, want a Dutch win", result)
+			}
+			if result.CloseSeq != result.Seq+1 {
+				t.Fatalf("CloseSeq = %d, want %d (after the bid's seq)", result.CloseSeq, result.Seq+1)
+			}
+
+			entries, err := client.ReadOutbox(ctx, outboxShard(item.ID), "test", 10, time.Minute, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("got %d outbox entries, want the bid and the close", len(entries))
+			}
+			bid, closed := entries[0], entries[1]
+			if bid.Kind != OutboxKindBid || bid.Result.Seq != result.Seq || bid.Result.CloseSeq != result.CloseSeq {
+				t.Errorf("first entry = %s seq %d, want the bid with seq %d", bid.Kind, bid.Result.Seq, result.Seq)
+			}
+			if closed.Kind != OutboxKindClosed {
+				t.Fatalf("second entry is a %s entry, want %s", closed.Kind, OutboxKindClosed)
+			}
+			want := CloseResult{FinalPrice: 10000, WinnerID: "buyer", ReserveMet: true, Seq: result.CloseSeq}
+			if *closed.Close != want {
+				t.Errorf("close = %+v, want %+v", *closed.Close, want)
+			}
+			if closed.Item.Name != item.Name || closed.Item.Currency != item.Currency || closed.Item.AuctionType != models.AuctionTypeDutch {
+				t.Errorf("closed item = %+v, want the item's fields", closed.Item)
+			}
+
+			stored, err := client.GetItem(ctx, item.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Seq != result.CloseSeq || stored.Status != models.ItemStatusClosed {
+				t.Errorf("item seq %d status %s, want seq %d closed", stored.Seq, stored.Status, result.CloseSeq)
+			}
+		})
+	}
+}
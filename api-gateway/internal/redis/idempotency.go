@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrIdempotencyKeyReused is returned by PlaceBid when the idempotency key was
+// already used for a bid on another item
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for another item")
+
+// idempotencyTTL is how long the result of an accepted bid is kept for retries
+const idempotencyTTL = 24 * time.Hour
+
+// Idempotency identifies a bid request across client retries
+type Idempotency struct {
+	Key       string // Client's Idempotency-Key (empty for none)
+	RequestID string // Stored with the result, so that replays report the original request
+}
+
+// idempotencyKey returns the list holding the stored result of a user's bid
+// Keys are per user, so users can't replay each other's results
+func idempotencyKey(userID, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", userID, key)
+}
+
+// getStoredBid mirrors the replay of the bid script for the optimistic strategy:
+// returns the stored result for the idempotency key, or nil if there is none
+func getStoredBid(ctx context.Context, tx *redis.Tx, itemID, userID string, idem Idempotency) (*BidResult, error) {
+	stored, err := tx.LRange(ctx, idempotencyKey(userID, idem.Key), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored bid: %w", err)
+	}
+	if len(stored) == 0 {
+		return nil, nil
+	}
+	if len(stored) < 2 || stored[0] != itemID {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	record := make([]interface{}, 0, len(stored)-2)
+	for _, value := range stored[2:] {
+		record = append(record, value)
+	}
+	result, err := parseBidResult(userID, record)
+	if err != nil {
+		return nil, err
+	}
+	result.RequestID = stored[1]
+	result.Replayed = true
+	return result, nil
+}
+
+// storeBid mirrors accept of the bid script for the optimistic strategy: queues
+// storing the result of an accepted bid in the transaction that places it
+func storeBid(ctx context.Context, pipe redis.Pipeliner, itemID, userID string, idem Idempotency, result *BidResult) {
+	if idem.Key == "" {
+		return
+	}
+	key := idempotencyKey(userID, idem.Key)
+	record := append([]interface{}{itemID, idem.RequestID}, encodeBidResult(result)...)
+	pipe.RPush(ctx, key, record...)
+	pipe.PExpire(ctx, key, idempotencyTTL)
+}
+
+// encodeBidResult encodes an accepted bid in the result format of the bid script
+func encodeBidResult(result *BidResult) []interface{} {
+	code := 1
+	switch {
+	case result.Sealed:
+		code = 3
+	case result.Dutch:
+		code = 5
+	case result.MaxRaised:
+		code = 2
+	}
+
+	record := []interface{}{
+		code,
+		int64(result.PreviousBid),
+		result.EndTime.UnixMilli(),
+		boolFlag(result.Extended),
+		int64(result.MinNextBid),
+		boolFlag(result.ReserveMet),
+		result.Seq,
+		result.OutbidUserID,
+	}
+	if result.Sealed {
+		return append(record, result.BidCount)
+	}
+	for _, step := range result.Steps {
+		record = append(record, step.UserID, int64(step.Amount), boolFlag(step.Proxy))
+	}
+	if result.Dutch {
+		record = append(record, result.CloseSeq)
+	}
+	return record
+}
+
+// boolFlag encodes a flag as the bid script does
+func boolFlag(flag bool) int {
+	if flag {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,644 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// Item errors returned by the item lifecycle operations
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrItemExists   = errors.New("item already exists")
+	ErrItemClosed   = errors.New("item is closed")
+)
+
+// closingSetKey is the sorted set of open items scored by end time (unix ms)
+// The auction closer polls it for items whose auction has ended
+const closingSetKey = "items:closing"
+
+// createItemLua creates the item hash only if it doesn't exist yet
+const createItemLua = `
+	-- KEYS[1]: item:{itemID} (item metadata hash)
+	-- KEYS[2]: items:closing (sorted set of open items by end time)
+	-- ARGV[1]: item ID
+	-- ARGV[2]: end time (unix ms)
+	-- ARGV[3..]: field/value pairs
+
+	if redis.call('EXISTS', KEYS[1]) == 1 then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+	return 1
+`
+
+// updateItemLua updates an existing item unless it has been closed
+// Schedule fields (price, times, soft close) can only change before the auction
+// starts: once bids may exist, end_time is owned by the bid script (soft close)
+const updateItemLua = `
+	-- KEYS[1]: item:{itemID} (item metadata hash)
+	-- KEYS[2]: items:closing (sorted set of open items by end time)
+	-- ARGV[1]: item ID
+	-- ARGV[2]: current time (unix ms)
+	-- ARGV[3]: number of detail field/value arguments (N)
+	-- ARGV[4..3+N]: detail field/value pairs (name, description)
+	-- ARGV[4+N..]: schedule field/value pairs, end_time first (optional)
+
+	local item = redis.call('HMGET', KEYS[1], 'status', 'start_time')
+	if not item[1] then
+		return -1
+	end
+	if item[1] == 'closed' then
+		return 0
+	end
+
+	local n = tonumber(ARGV[3])
+	if #ARGV > 3 + n then
+		if tonumber(ARGV[2]) >= tonumber(item[2]) then
+			return -2
+		end
+		redis.call('HSET', KEYS[1], unpack(ARGV, 4 + n))
+		redis.call('ZADD', KEYS[2], ARGV[5 + n], ARGV[1])
+	end
+	redis.call('HSET', KEYS[1], unpack(ARGV, 4, 3 + n))
+	return 1
+`
+
+// closeItemLua moves an item to the closed state exactly once and returns the
+// final price and winner (if the reserve price was met). Since the bid script checks the status in the same
+// Redis, no bid can be accepted after this script ran
+// Sealed auctions are decided here: the highest sealed bid wins (earliest on a tie)
+// and pays its own amount, or in second-price auctions the second-highest bid
+// (at least the start price and the reserve)
+// With several gateway replicas only the one getting code 1 publishes the result;
+// the result is also appended to the outbox in the same script, so it reaches the
+// archive even if that publish is lost
+const closeItemLua = appendClosedLua + `
+	-- KEYS[1]: item:{itemID} (item metadata hash)
+	-- KEYS[2]: items:closing (sorted set of open items by end time)
+	-- KEYS[3]: item:{itemID}:current_bid
+	-- KEYS[4]: item:{itemID}:highest_bidder
+	-- KEYS[5]: item:{itemID}:sealed_bids (hash of user ID -> "amount:time_ms")
+	-- KEYS[6]: outbox:{shard} (stream the close is relayed to JetStream from)
+	-- ARGV[1]: item ID
+	-- ARGV[2]: close timestamp (unix ms)
+	-- ARGV[3]: 1 to close before end time (manual close), 0 to only close ended auctions
+
+	local function money(value)
+		return math.floor(tonumber(value) or 0)
+	end
+
+	local item = redis.call('HMGET', KEYS[1], 'status', 'end_time', 'reserve_price', 'auction_type', 'start_price')
+	if not item[1] then
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		return {-1, '0', '', 0, 0}
+	end
+	if item[1] == 'closed' then
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		return {0, '0', '', 0, 0}
+	end
+	if ARGV[3] == '0' and tonumber(ARGV[2]) < tonumber(item[2]) then
+		-- End time was extended since the closer read it, reschedule
+		redis.call('ZADD', KEYS[2], item[2], ARGV[1])
+		return {-2, '0', '', 0, 0}
+	end
+
+	local reserve = money(item[3])
+	if item[4] == 'sealed_first_price' or item[4] == 'sealed_second_price' then
+		-- Reveal: pick the highest and second-highest sealed bids
+		local bids = redis.call('HGETALL', KEYS[5])
+		local best, best_time, second, leader = 0, 0, 0, ''
+		for i = 1, #bids, 2 do
+			local amount, bid_time = string.match(bids[i + 1], '^(%d+):(%d+)$')
+			amount = tonumber(amount)
+			bid_time = tonumber(bid_time)
+			if amount > best or (amount == best and bid_time < best_time) then
+				second = best
+				best, best_time, leader = amount, bid_time, bids[i]
+			elseif amount > second then
+				second = amount
+			end
+		end
+		if leader ~= '' then
+			local price = best
+			if item[4] == 'sealed_second_price' and best >= reserve then
+				price = math.max(second, money(item[5]), reserve)
+			end
+			redis.call('SET', KEYS[3], string.format('%d', price))
+			redis.call('SET', KEYS[4], leader)
+		end
+	end
+
+	local final_price = redis.call('GET', KEYS[3]) or '0'
+	local winner = redis.call('GET', KEYS[4]) or ''
+
+	-- Nobody wins if the highest bid didn't reach the hidden reserve price
+	local reserve_met = 1
+	if winner == '' or money(final_price) < reserve then
+		reserve_met = 0
+		winner = ''
+	end
+
+	redis.call('HSET', KEYS[1], 'status', 'closed', 'winner_id', winner, 'updated_at', ARGV[2])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	local seq = append_closed(KEYS[1], KEYS[6], ARGV[1], ARGV[2], final_price, winner, reserve_met, 0)
+	return {1, final_price, winner, reserve_met, seq}
+`
+
+// appendClosedLua defines append_closed, shared by the close, buy-now and bid
+// (Dutch wins) scripts: it bumps the item's sequence number, so the close orders
+// after the item's last bid, and appends the close to the item's outbox shard
+// with the item fields of its AuctionClosedEvent
+// Returns the sequence number of the close
+const appendClosedLua = `
+	local function append_closed(item_key, outbox_key, item_id, closed_at, final_price, winner, reserve_met, buy_now)
+		local seq = redis.call('HINCRBY', item_key, 'seq', 1)
+		local item = redis.call('HMGET', item_key, 'name', 'description', 'start_price',
+			'start_time', 'end_time', 'auction_type', 'currency')
+		redis.call('XADD', outbox_key, '*',
+			'kind', 'closed', 'item_id', item_id, 'ts', closed_at, 'seq', seq,
+			'final_price', final_price, 'winner_id', winner,
+			'reserve_met', reserve_met, 'buy_now', buy_now,
+			'name', item[1] or '', 'description', item[2] or '', 'start_price', item[3] or '0',
+			'start_time', item[4] or '0', 'end_time', item[5] or '0',
+			'auction_type', item[6] or '', 'currency', item[7] or '')
+		return seq
+	end
+`
+
+// ErrAuctionNotEnded is returned by CloseEndedItem when the item's end time
+// was moved past the close timestamp
+var ErrAuctionNotEnded = errors.New("auction has not ended")
+
+// ErrAuctionStarted is returned by UpdateItem when schedule fields are changed
+// after the auction has started
+var ErrAuctionStarted = errors.New("auction has already started")
+
+// CloseResult represents the outcome of closing an auction
+type CloseResult struct {
+	FinalPrice models.Money
+	WinnerID   string // Empty if nobody bid or the reserve wasn't met
+	ReserveMet bool
+	BuyNow     bool  // Closed by a buy-now at the buy-now price
+	Seq        int64 // Item sequence number of the close, after the last bid
+}
+
+// itemKey returns the Redis key of the item metadata hash
+func itemKey(itemID string) string {
+	return fmt.Sprintf("item:%s", itemID)
+}
+
+// CreateItem stores a new item in Redis
+// Returns ErrItemExists if an item with the same ID was already created
+func (c *Client) CreateItem(ctx context.Context, item *models.Item) error {
+	args := []interface{}{
+		"id", item.ID,
+		"name", item.Name,
+		"description", item.Description,
+		"start_price", item.StartPrice,
+		"currency", item.Currency,
+		"seller_id", item.SellerID,
+		"status", item.Status,
+		"start_time", item.StartTime.UnixMilli(),
+		"end_time", item.EndTime.UnixMilli(),
+		"created_at", item.CreatedAt.UnixMilli(),
+		"updated_at", item.UpdatedAt.UnixMilli(),
+	}
+	args = append(args, softCloseFields(item)...)
+	args = append(args, biddingRuleFields(item)...)
+	args = append(args, dutchFields(item)...)
+
+	keys := []string{itemKey(item.ID), closingSetKey}
+	args = append([]interface{}{item.ID, item.EndTime.UnixMilli()}, args...)
+
+	created, err := c.createItemScript.Run(ctx, c.client, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to create item: %w", err)
+	}
+	if created == 0 {
+		return ErrItemExists
+	}
+	return nil
+}
+
+// UpdateItem overwrites the mutable fields of an existing item
+// Schedule fields are only written when scheduleChanged is set, which is
+// rejected with ErrAuctionStarted once the auction has started
+// Returns ErrItemNotFound or ErrItemClosed if the item can't be edited
+func (c *Client) UpdateItem(ctx context.Context, item *models.Item, scheduleChanged bool, now time.Time) error {
+	details := []interface{}{
+		"name", item.Name,
+		"description", item.Description,
+		"updated_at", item.UpdatedAt.UnixMilli(),
+	}
+
+	keys := []string{itemKey(item.ID), closingSetKey}
+	args := append([]interface{}{item.ID, now.UnixMilli(), len(details)}, details...)
+	if scheduleChanged {
+		args = append(args,
+			"end_time", item.EndTime.UnixMilli(),
+			"start_time", item.StartTime.UnixMilli(),
+			"start_price", item.StartPrice,
+		)
+		args = append(args, softCloseFields(item)...)
+		args = append(args, biddingRuleFields(item)...)
+		args = append(args, dutchFields(item)...)
+	}
+
+	result, err := c.updateItemScript.Run(ctx, c.client, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update item: %w", err)
+	}
+	switch result {
+	case -1:
+		return ErrItemNotFound
+	case 0:
+		return ErrItemClosed
+	case -2:
+		return ErrAuctionStarted
+	}
+	return nil
+}
+
+// CloseItem closes an auction immediately, even before its end time
+// Returns ErrItemNotFound if the item doesn't exist and ErrItemClosed if it was already closed
+func (c *Client) CloseItem(ctx context.Context, itemID string, closedAt time.Time) (*CloseResult, error) {
+	return c.closeItem(ctx, itemID, closedAt, true)
+}
+
+// CloseEndedItem closes an auction whose end time has passed
+// Returns ErrAuctionNotEnded if the end time is still ahead of closedAt, and the
+// same errors as CloseItem otherwise
+func (c *Client) CloseEndedItem(ctx context.Context, itemID string, closedAt time.Time) (*CloseResult, error) {
+	return c.closeItem(ctx, itemID, closedAt, false)
+}
+
+// closeItem runs the close script and parses its [code, final_price, winner, reserve_met] result
+func (c *Client) closeItem(ctx context.Context, itemID string, closedAt time.Time, force bool) (*CloseResult, error) {
+	keys := []string{
+		itemKey(itemID),
+		closingSetKey,
+		fmt.Sprintf("item:%s:current_bid", itemID),
+		fmt.Sprintf("item:%s:highest_bidder", itemID),
+		sealedBidsKey(itemID),
+		outboxKey(outboxShard(itemID)),
+	}
+	forceArg := 0
+	if force {
+		forceArg = 1
+	}
+
+	result, err := c.closeItemScript.Run(ctx, c.client, keys, itemID, closedAt.UnixMilli(), forceArg).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close item: %w", err)
+	}
+	if len(result) != 5 {
+		return nil, fmt.Errorf("unexpected close script result format")
+	}
+
+	switch result[0].(int64) {
+	case -1:
+		return nil, ErrItemNotFound
+	case 0:
+		return nil, ErrItemClosed
+	case -2:
+		return nil, ErrAuctionNotEnded
+	}
+
+	finalPrice, err := strconv.ParseInt(result[1].(string), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse final price of item %s: %w", itemID, err)
+	}
+
+	return &CloseResult{
+		FinalPrice: models.Money(finalPrice),
+		WinnerID:   result[2].(string),
+		ReserveMet: result[3].(int64) == 1,
+		Seq:        result[4].(int64),
+	}, nil
+}
+
+// ItemMeta holds the item fields that never change after creation
+type ItemMeta struct {
+	Currency string
+	SellerID string // Empty for items created without a seller
+}
+
+// GetItemMeta returns the immutable fields of an item
+// Returns ErrItemNotFound if the item doesn't exist
+func (c *Client) GetItemMeta(ctx context.Context, itemID string) (*ItemMeta, error) {
+	values, err := c.client.HMGet(ctx, itemKey(itemID), "status", "currency", "seller_id").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata of item %s: %w", itemID, err)
+	}
+	if values[0] == nil {
+		return nil, ErrItemNotFound
+	}
+	currency, _ := values[1].(string)
+	sellerID, _ := values[2].(string)
+	return &ItemMeta{
+		Currency: itemCurrency(map[string]string{"currency": currency}),
+		SellerID: sellerID,
+	}, nil
+}
+
+// GetEndedItems returns up to limit IDs of open items whose end time is at or before now
+func (c *Client) GetEndedItems(ctx context.Context, now time.Time, limit int64) ([]string, error) {
+	ids, err := c.client.ZRangeByScore(ctx, closingSetKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ended items: %w", err)
+	}
+	return ids, nil
+}
+
+// GetItem retrieves the full item, including its current highest bid
+// Returns ErrItemNotFound if the item was never created
+func (c *Client) GetItem(ctx context.Context, itemID string) (*models.Item, error) {
+	pipe := c.client.Pipeline()
+
+	fieldsCmd := pipe.HGetAll(ctx, itemKey(itemID))
+	bidCmd := pipe.Get(ctx, fmt.Sprintf("item:%s:current_bid", itemID))
+	bidderCmd := pipe.Get(ctx, fmt.Sprintf("item:%s:highest_bidder", itemID))
+
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	fields := fieldsCmd.Val()
+	if len(fields) == 0 {
+		return nil, ErrItemNotFound
+	}
+
+	item, err := parseItem(itemID, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	hasBids := bidCmd.Err() == nil
+	if hasBids {
+		item.CurrentBid = parseMoney(bidCmd.Val())
+	}
+	if bidderCmd.Err() == nil {
+		item.HighestBidderID = bidderCmd.Val()
+	}
+	item.MinNextBid = minNextBid(fields, item.CurrentBid, hasBids)
+	item.ReserveMet = reserveMet(fields, item.CurrentBid, hasBids)
+	if item.AuctionType == models.AuctionTypeDutch && item.Status != models.ItemStatusClosed {
+		// The clock price is the only bid accepted
+		item.ClockPrice = dutchClockPrice(fields, time.Now().UnixMilli())
+		item.MinNextBid = item.ClockPrice
+	}
+
+	return item, nil
+}
+
+// auctionRejectReason mirrors the auction window check of the bid script for the
+// optimistic strategy: returns the rejection reason for the item metadata hash
+// at the given time (unix ms), or an empty string if bids are accepted
+func auctionRejectReason(fields map[string]string, now int64) string {
+	status, ok := fields["status"]
+	if !ok {
+		return models.BidRejectItemNotFound
+	}
+	if status == models.ItemStatusClosed {
+		return models.BidRejectAuctionClosed
+	}
+	startTime, _ := strconv.ParseInt(fields["start_time"], 10, 64)
+	endTime, _ := strconv.ParseInt(fields["end_time"], 10, 64)
+	if now < startTime {
+		return models.BidRejectNotStarted
+	}
+	if now >= endTime {
+		return models.BidRejectEnded
+	}
+	return ""
+}
+
+// softCloseEndTime mirrors the soft-close rule of the bid script for the
+// optimistic strategy: returns the end time (unix ms) after a bid accepted at
+// now, and whether the bid extended it
+func softCloseEndTime(fields map[string]string, now int64) (int64, bool) {
+	endTime, _ := strconv.ParseInt(fields["end_time"], 10, 64)
+	window, _ := strconv.ParseInt(fields["soft_close_window_ms"], 10, 64)
+	if window <= 0 || endTime-now >= window {
+		return endTime, false
+	}
+
+	extension, _ := strconv.ParseInt(fields["soft_close_extension_ms"], 10, 64)
+	maxEndTime, _ := strconv.ParseInt(fields["max_end_time"], 10, 64)
+	newEndTime := endTime + extension
+	if maxEndTime > 0 && newEndTime > maxEndTime {
+		newEndTime = maxEndTime
+	}
+	if newEndTime <= endTime {
+		return endTime, false
+	}
+	return newEndTime, true
+}
+
+// minNextBid mirrors the bidding rules of the bid script: returns the lowest
+// bid accepted when the highest bid is currentBid (hasBids is false before the
+// first bid, when the start price applies)
+func minNextBid(fields map[string]string, currentBid models.Money, hasBids bool) models.Money {
+	if !hasBids {
+		startPrice := parseMoney(fields["start_price"])
+		if startPrice <= 0 {
+			return models.DefaultMinIncrement
+		}
+		return startPrice
+	}
+
+	return currentBid + incrementAt(fields, currentBid)
+}
+
+// incrementAt returns the minimum raise at a price, from the increment tier the
+// price falls in or the item's fixed minimum increment
+func incrementAt(fields map[string]string, price models.Money) models.Money {
+	increment := parseMoney(fields["min_increment"])
+	for _, tier := range parseIncrementTiers(fields["increment_tiers"]) {
+		if price >= tier.From {
+			increment = tier.Increment
+		}
+	}
+	if increment <= 0 {
+		return models.DefaultMinIncrement
+	}
+	return increment
+}
+
+// reserveMet reports whether the highest bid reached the item's hidden reserve price
+func reserveMet(fields map[string]string, highestBid models.Money, hasBids bool) bool {
+	return hasBids && highestBid >= parseMoney(fields["reserve_price"])
+}
+
+// itemSeq returns the sequence number of the item metadata hash, bumped by the
+// bid script with every visible price change (0 before the first bid)
+func itemSeq(fields map[string]string) int64 {
+	seq, _ := strconv.ParseInt(fields["seq"], 10, 64)
+	return seq
+}
+
+// parseMoney decodes an amount stored in Redis as integer minor units (0 if empty)
+func parseMoney(value string) models.Money {
+	amount, _ := strconv.ParseInt(value, 10, 64)
+	return models.Money(amount)
+}
+
+// itemCurrency returns the currency of the item metadata hash
+// Items created before amounts had a currency are in the default currency
+func itemCurrency(fields map[string]string) string {
+	if currency := fields["currency"]; currency != "" {
+		return currency
+	}
+	return models.DefaultCurrency
+}
+
+// biddingRuleFields returns the item hash fields storing its bidding rules
+func biddingRuleFields(item *models.Item) []interface{} {
+	return []interface{}{
+		"min_increment", item.MinIncrement,
+		"increment_tiers", formatIncrementTiers(item.IncrementTiers),
+		"reserve_price", item.ReservePrice,
+		"buy_now_price", item.BuyNowPrice,
+		"auction_type", item.AuctionType,
+	}
+}
+
+// formatIncrementTiers encodes tiers as "from:increment,..." in minor units for the bid script
+func formatIncrementTiers(tiers []models.IncrementTier) string {
+	parts := make([]string, 0, len(tiers))
+	for _, tier := range tiers {
+		parts = append(parts, fmt.Sprintf("%d:%d", tier.From, tier.Increment))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseIncrementTiers decodes the "from:increment,..." encoding of increment tiers
+func parseIncrementTiers(encoded string) []models.IncrementTier {
+	if encoded == "" {
+		return nil
+	}
+	var tiers []models.IncrementTier
+	for _, part := range strings.Split(encoded, ",") {
+		from, increment, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		tier := models.IncrementTier{}
+		tier.From = parseMoney(from)
+		tier.Increment = parseMoney(increment)
+		tiers = append(tiers, tier)
+	}
+	return tiers
+}
+
+// softCloseFields returns the item hash fields storing its soft-close rule
+// max_end_time caps extensions relative to the scheduled end time (0 = no cap)
+func softCloseFields(item *models.Item) []interface{} {
+	var window, extension, maxExtension, maxEndTime int64
+	if rule := item.SoftClose; rule != nil {
+		window = int64(rule.WindowSeconds) * 1000
+		extension = int64(rule.ExtensionSeconds) * 1000
+		maxExtension = int64(rule.MaxExtensionSeconds) * 1000
+		if maxExtension > 0 {
+			maxEndTime = item.EndTime.UnixMilli() + maxExtension
+		}
+	}
+	return []interface{}{
+		"soft_close_window_ms", window,
+		"soft_close_extension_ms", extension,
+		"soft_close_max_extension_ms", maxExtension,
+		"max_end_time", maxEndTime,
+	}
+}
+
+// parseItem converts the item metadata hash into a models.Item
+func parseItem(itemID string, fields map[string]string) (*models.Item, error) {
+	item := &models.Item{
+		ID:          itemID,
+		Name:        fields["name"],
+		Description: fields["description"],
+		Status:      fields["status"],
+		AuctionType: fields["auction_type"],
+		Currency:    itemCurrency(fields),
+		SellerID:    fields["seller_id"],
+		WinnerID:    fields["winner_id"],
+	}
+	if item.AuctionType == "" {
+		item.AuctionType = models.AuctionTypeEnglish
+	}
+	item.BidCount, _ = strconv.ParseInt(fields["bid_count"], 10, 64)
+	item.Seq = itemSeq(fields)
+
+	if v, ok := fields["start_price"]; ok {
+		startPrice, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse start price of item %s: %w", itemID, err)
+		}
+		item.StartPrice = models.Money(startPrice)
+	}
+
+	amounts := []struct {
+		field string
+		dest  *models.Money
+	}{
+		{"min_increment", &item.MinIncrement},
+		{"reserve_price", &item.ReservePrice},
+		{"buy_now_price", &item.BuyNowPrice},
+	}
+	for _, f := range amounts {
+		*f.dest = parseMoney(fields[f.field])
+	}
+	item.IncrementTiers = parseIncrementTiers(fields["increment_tiers"])
+	item.HasReserve = item.ReservePrice > 0
+
+	timestamps := []struct {
+		field string
+		dest  *time.Time
+	}{
+		{"start_time", &item.StartTime},
+		{"end_time", &item.EndTime},
+		{"created_at", &item.CreatedAt},
+		{"updated_at", &item.UpdatedAt},
+	}
+	for _, ts := range timestamps {
+		v, ok := fields[ts.field]
+		if !ok {
+			continue
+		}
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s of item %s: %w", ts.field, itemID, err)
+		}
+		*ts.dest = time.UnixMilli(ms).UTC()
+	}
+
+	window, _ := strconv.ParseInt(fields["soft_close_window_ms"], 10, 64)
+	if window > 0 {
+		extension, _ := strconv.ParseInt(fields["soft_close_extension_ms"], 10, 64)
+		maxExtension, _ := strconv.ParseInt(fields["soft_close_max_extension_ms"], 10, 64)
+		item.SoftClose = &models.SoftCloseRule{
+			WindowSeconds:       int(window / 1000),
+			ExtensionSeconds:    int(extension / 1000),
+			MaxExtensionSeconds: int(maxExtension / 1000),
+		}
+	}
+
+	if item.AuctionType == models.AuctionTypeDutch {
+		item.Dutch = parseDutchRule(fields)
+	}
+
+	return item, nil
+}
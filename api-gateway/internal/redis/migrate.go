@@ -0,0 +1,180 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// Keys of the money migration
+// The version key records that all amounts are stored as integer minor units;
+// the set remembers converted items so an interrupted migration never converts twice
+const (
+	moneyVersionKey  = "schema:money_version"
+	moneyLockKey     = "schema:money_lock"
+	moneyMigratedKey = "schema:money_migrated"
+	moneyVersion     = 1
+)
+
+// migrateItemMoneyLua converts the amounts of one item from decimal strings
+// ("100.50") to integer minor units ("10050") and records the item as migrated
+// Sealed bids were always stored in minor units and are left alone
+const migrateItemMoneyLua = `
+	-- KEYS[1]: item:{itemID} (item metadata hash)
+	-- KEYS[2]: item:{itemID}:current_bid
+	-- KEYS[3]: item:{itemID}:proxy_max
+	-- KEYS[4]: schema:money_migrated
+	-- ARGV[1]: item ID
+	-- ARGV[2]: currency of items created before amounts had one
+	--
+	-- Returns 1 if converted, 0 if already converted
+
+	if redis.call('SISMEMBER', KEYS[4], ARGV[1]) == 1 then
+		return 0
+	end
+
+	local function minor_units(amount)
+		return string.format('%d', math.floor((tonumber(amount) or 0) * 100 + 0.5))
+	end
+
+	local bid = redis.call('GET', KEYS[2])
+	if bid then
+		redis.call('SET', KEYS[2], minor_units(bid))
+	end
+
+	local maxima = redis.call('HGETALL', KEYS[3])
+	for i = 1, #maxima, 2 do
+		redis.call('HSET', KEYS[3], maxima[i], minor_units(maxima[i + 1]))
+	end
+
+	if redis.call('EXISTS', KEYS[1]) == 1 then
+		local fields = {'start_price', 'min_increment', 'reserve_price', 'buy_now_price',
+			'dutch_floor_price', 'dutch_decrement'}
+		local values = redis.call('HMGET', KEYS[1], unpack(fields))
+		for i, field in ipairs(fields) do
+			if values[i] then
+				redis.call('HSET', KEYS[1], field, minor_units(values[i]))
+			end
+		end
+
+		local tiers = redis.call('HGET', KEYS[1], 'increment_tiers')
+		if tiers and tiers ~= '' then
+			tiers = string.gsub(tiers, '([%d%.]+):([%d%.]+)', function(from, step)
+				return minor_units(from) .. ':' .. minor_units(step)
+			end)
+			redis.call('HSET', KEYS[1], 'increment_tiers', tiers)
+		end
+
+		if not redis.call('HGET', KEYS[1], 'currency') then
+			redis.call('HSET', KEYS[1], 'currency', ARGV[2])
+		end
+	end
+
+	redis.call('SADD', KEYS[4], ARGV[1])
+	return 1
+`
+
+// MigrateMoney converts the amounts stored by earlier versions (decimal strings)
+// to integer minor units, once. Replicas starting together wait for the one
+// holding the lock to finish
+func (c *Client) MigrateMoney(ctx context.Context) error {
+	version, err := c.client.Get(ctx, moneyVersionKey).Int()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get money schema version: %w", err)
+	}
+	if version >= moneyVersion {
+		return nil
+	}
+
+	locked, err := c.client.SetNX(ctx, moneyLockKey, "1", 5*time.Minute).Result()
+	if err != nil {
+		return fmt.Errorf("failed to acquire money migration lock: %w", err)
+	}
+	if !locked {
+		return c.waitForMoneyMigration(ctx)
+	}
+	defer c.client.Del(context.Background(), moneyLockKey)
+
+	itemIDs, err := c.scanItemIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	script := redis.NewScript(migrateItemMoneyLua)
+	converted := 0
+	for _, itemID := range itemIDs {
+		keys := []string{
+			itemKey(itemID),
+			fmt.Sprintf("item:%s:current_bid", itemID),
+			proxyKey(itemID),
+			moneyMigratedKey,
+		}
+		n, err := script.Run(ctx, c.client, keys, itemID, models.DefaultCurrency).Int()
+		if err != nil {
+			return fmt.Errorf("failed to migrate amounts of item %s: %w", itemID, err)
+		}
+		converted += n
+	}
+
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, moneyVersionKey, moneyVersion, 0)
+	pipe.Del(ctx, moneyMigratedKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set money schema version: %w", err)
+	}
+
+	fmt.Printf("[MIGRATE] Converted amounts of %d items to minor units\n", converted)
+	return nil
+}
+
+// waitForMoneyMigration blocks until another replica finished the migration
+func (c *Client) waitForMoneyMigration(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for money migration: %w", ctx.Err())
+		case <-ticker.C:
+		}
+
+		version, err := c.client.Get(ctx, moneyVersionKey).Int()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to get money schema version: %w", err)
+		}
+		if version >= moneyVersion {
+			return nil
+		}
+		// The migrating replica died and its lock expired, take over
+		if exists, err := c.client.Exists(ctx, moneyLockKey).Result(); err == nil && exists == 0 {
+			return c.MigrateMoney(ctx)
+		}
+	}
+}
+
+// scanItemIDs returns the IDs of all items with a metadata hash or a current bid
+func (c *Client) scanItemIDs(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var itemIDs []string
+
+	iter := c.client.Scan(ctx, 0, "item:*", 1000).Iterator()
+	for iter.Next(ctx) {
+		rest := strings.TrimPrefix(iter.Val(), "item:")
+		itemID, suffix, found := strings.Cut(rest, ":")
+		if found && suffix != "current_bid" {
+			continue
+		}
+		if !seen[itemID] {
+			seen[itemID] = true
+			itemIDs = append(itemIDs, itemID)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan items: %w", err)
+	}
+	return itemIDs, nil
+}
@@ -0,0 +1,385 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// OutboxShards is the number of outbox streams; an item's entries always go to
+// the same shard, but relays of several replicas and reclaimed entries may still
+// deliver them out of order, which the archival worker's seq guard absorbs
+// Changing it orphans the entries of removed shards, so it is fixed
+const OutboxShards = 8
+
+// outboxGroup is the consumer group of the outbox relays of all gateway replicas
+const outboxGroup = "relay"
+
+// Outbox entry kinds
+const (
+	OutboxKindBid    = "bid"    // Accepted bid (entries without a kind are bids)
+	OutboxKindClosed = "closed" // Closed auction, appended by the close and buy-now scripts
+	OutboxKindReset  = "reset"  // Price reset by an admin
+)
+
+// OutboxEntry is an accepted bid, a closed auction or a price reset waiting in
+// the outbox to be relayed to JetStream
+type OutboxEntry struct {
+	ID         string // Stream entry ID, to acknowledge it
+	Shard      int
+	Kind       string // OutboxKindBid, OutboxKindClosed or OutboxKindReset
+	ItemID     string
+	RequestID  string // Request ID the bid's event IDs derive from
+	UserID     string
+	Amount     models.Money // Amount of the request (the bid of sealed auctions)
+	Currency   string
+	Timestamp  time.Time // When the bid was accepted, the auction closed or the price was reset
+	Result     *BidResult
+	Deliveries int64 // Times a relay read the entry, including this one
+
+	// Closed auctions only
+	Item  *models.Item // Item fields of the AuctionClosedEvent, as of the close
+	Close *CloseResult
+
+	// Price resets only
+	Reset *PriceReset
+}
+
+// outboxKey returns the Redis stream of an outbox shard
+func outboxKey(shard int) string {
+	return fmt.Sprintf("outbox:%d", shard)
+}
+
+// deadLetterKey returns the Redis stream of the dead letters of an outbox shard
+func deadLetterKey(shard int) string {
+	return fmt.Sprintf("outbox:dead:%d", shard)
+}
+
+// deadLetterLua moves an outbox entry to its shard's dead-letter stream, with the
+// reason it couldn't be relayed, and acknowledges it in the outbox
+const deadLetterLua = `
+	-- KEYS[1]: outbox:{shard}
+	-- KEYS[2]: outbox:dead:{shard}
+	-- ARGV[1]: entry ID
+	-- ARGV[2]: consumer group
+	-- ARGV[3]: error
+	-- ARGV[4]: deliveries
+	--
+	-- Returns 1 if the entry was moved, 0 if it was already gone
+
+	local entries = redis.call('XRANGE', KEYS[1], ARGV[1], ARGV[1])
+	if #entries > 0 then
+		local fields = entries[1][2]
+		table.insert(fields, 'outbox_id')
+		table.insert(fields, ARGV[1])
+		table.insert(fields, 'error')
+		table.insert(fields, ARGV[3])
+		table.insert(fields, 'deliveries')
+		table.insert(fields, ARGV[4])
+		redis.call('XADD', KEYS[2], '*', unpack(fields))
+	end
+	redis.call('XACK', KEYS[1], ARGV[2], ARGV[1])
+	redis.call('XDEL', KEYS[1], ARGV[1])
+	return #entries
+`
+
+// outboxShard returns the outbox shard of an item
+func outboxShard(itemID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(itemID))
+	return int(h.Sum32() % OutboxShards)
+}
+
+// appendOutbox mirrors accept of the bid script for the optimistic strategy:
+// queues the outbox entry of an accepted bid in the transaction that places it
+// A leader raising their own maximum changed nothing visible and isn't relayed
+func appendOutbox(ctx context.Context, pipe redis.Pipeliner, itemID, userID string, amount models.Money, currency string, now int64, idem Idempotency, result *BidResult) {
+	if result.MaxRaised {
+		return
+	}
+	encoded := make([]string, 0, 8)
+	for _, value := range encodeBidResult(result) {
+		encoded = append(encoded, fmt.Sprint(value))
+	}
+	data, _ := json.Marshal(encoded)
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: outboxKey(outboxShard(itemID)),
+		Values: []interface{}{
+			"item_id", itemID, "request_id", idem.RequestID, "user_id", userID,
+			"amount", amount, "currency", currency, "ts", now,
+			"result", string(data),
+		},
+	})
+}
+
+// appendClosed mirrors append_closed of the close scripts for the optimistic
+// strategy: queues the outbox entry of an item closed at closedAt (unix ms) with
+// result, in the transaction that closes it; fields is the item metadata hash
+// The caller bumps the item's sequence number to result.Seq
+func appendClosed(ctx context.Context, pipe redis.Pipeliner, itemID string, fields map[string]string, closedAt int64, result *CloseResult) {
+	field := func(name, fallback string) string {
+		if value, ok := fields[name]; ok {
+			return value
+		}
+		return fallback
+	}
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: outboxKey(outboxShard(itemID)),
+		Values: []interface{}{
+			"kind", OutboxKindClosed, "item_id", itemID, "ts", closedAt, "seq", result.Seq,
+			"final_price", result.FinalPrice, "winner_id", result.WinnerID,
+			"reserve_met", boolFlag(result.ReserveMet), "buy_now", boolFlag(result.BuyNow),
+			"name", field("name", ""), "description", field("description", ""),
+			"start_price", field("start_price", "0"), "start_time", field("start_time", "0"),
+			"end_time", field("end_time", "0"), "auction_type", field("auction_type", ""),
+			"currency", field("currency", ""),
+		},
+	})
+}
+
+// recordBid queues everything the bid script records with an accepted bid
+func recordBid(ctx context.Context, pipe redis.Pipeliner, itemID, userID string, amount models.Money, currency string, now int64, idem Idempotency, result *BidResult) {
+	appendOutbox(ctx, pipe, itemID, userID, amount, currency, now, idem, result)
+	pipe.SAdd(ctx, biddersKey(itemID), userID)
+	storeBid(ctx, pipe, itemID, userID, idem, result)
+}
+
+// EnsureOutbox creates the outbox streams and their relay consumer group
+func (c *Client) EnsureOutbox(ctx context.Context) error {
+	for shard := 0; shard < OutboxShards; shard++ {
+		err := c.client.XGroupCreateMkStream(ctx, outboxKey(shard), outboxGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create outbox group for shard %d: %w", shard, err)
+		}
+	}
+	return nil
+}
+
+// ReadOutbox returns up to count entries of an outbox shard for a relay consumer
+// Entries left unacknowledged for minIdle (their relay failed or died) are claimed
+// again first; otherwise it waits up to block for new entries
+func (c *Client) ReadOutbox(ctx context.Context, shard int, consumer string, count int64, minIdle, block time.Duration) ([]*OutboxEntry, error) {
+	stream := outboxKey(shard)
+
+	messages, _, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    outboxGroup,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox entries: %w", err)
+	}
+	deliveries, err := c.deliveryCounts(ctx, stream, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    outboxGroup,
+			Consumer: consumer,
+			Streams:  []string{stream, ">"},
+			Count:    count,
+			Block:    block,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to read outbox: %w", err)
+		}
+		for _, s := range streams {
+			messages = append(messages, s.Messages...)
+		}
+	}
+
+	entries := make([]*OutboxEntry, 0, len(messages))
+	for _, message := range messages {
+		count, claimed := deliveries[message.ID]
+		if !claimed {
+			count = 1 // Read for the first time
+		}
+		entry, err := parseOutboxEntry(shard, message)
+		if err != nil {
+			// A corrupt entry can never be relayed, don't block the shard on it
+			// If moving it fails, the batch is read again after minIdle
+			fmt.Printf("[OUTBOX] Moving unreadable entry %s of shard %d to %s: %v\n", message.ID, shard, deadLetterKey(shard), err)
+			if err := c.DeadLetterOutbox(ctx, shard, message.ID, count, err.Error()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry.Deliveries = count
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// deliveryCounts returns how often each of the claimed messages was delivered
+func (c *Client) deliveryCounts(ctx context.Context, stream string, messages []redis.XMessage) (map[string]int64, error) {
+	counts := make(map[string]int64, len(messages))
+	if len(messages) == 0 {
+		return counts, nil
+	}
+
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.XPendingExtCmd, len(messages))
+	for i, message := range messages {
+		cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  outboxGroup,
+			Start:  message.ID,
+			End:    message.ID,
+			Count:  1,
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get outbox delivery counts: %w", err)
+	}
+	for _, cmd := range cmds {
+		for _, pending := range cmd.Val() {
+			counts[pending.ID] = pending.RetryCount
+		}
+	}
+	return counts, nil
+}
+
+// DeadLetterOutbox moves an outbox entry that can't be relayed to the dead-letter
+// stream of its shard (outbox:dead:{shard}), so it no longer blocks the shard;
+// reason and deliveries are recorded with the entry's fields
+func (c *Client) DeadLetterOutbox(ctx context.Context, shard int, id string, deliveries int64, reason string) error {
+	keys := []string{outboxKey(shard), deadLetterKey(shard)}
+	if err := c.deadLetterScript.Run(ctx, c.client, keys, id, outboxGroup, reason, deliveries).Err(); err != nil {
+		return fmt.Errorf("failed to dead-letter outbox entry %s: %w", id, err)
+	}
+	return nil
+}
+
+// AckOutbox acknowledges relayed entries and removes them from the outbox
+func (c *Client) AckOutbox(ctx context.Context, shard int, ids ...string) error {
+	stream := outboxKey(shard)
+	pipe := c.client.TxPipeline()
+	pipe.XAck(ctx, stream, outboxGroup, ids...)
+	pipe.XDel(ctx, stream, ids...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge outbox entries: %w", err)
+	}
+	return nil
+}
+
+// parseOutboxEntry decodes an outbox stream entry
+func parseOutboxEntry(shard int, message redis.XMessage) (*OutboxEntry, error) {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+	switch field("kind") {
+	case OutboxKindClosed:
+		return parseClosedEntry(shard, message)
+	case OutboxKindReset:
+		return parseResetEntry(shard, message)
+	}
+
+	var encoded []string
+	if err := json.Unmarshal([]byte(field("result")), &encoded); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %w", err)
+	}
+	values := make([]interface{}, len(encoded))
+	for i, value := range encoded {
+		values[i] = value
+	}
+	userID := field("user_id")
+	result, err := parseBidResult(userID, values)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := strconv.ParseInt(field("ts"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+	result.RequestID = field("request_id")
+
+	return &OutboxEntry{
+		ID:        message.ID,
+		Shard:     shard,
+		Kind:      OutboxKindBid,
+		ItemID:    field("item_id"),
+		RequestID: result.RequestID,
+		UserID:    userID,
+		Amount:    parseMoney(field("amount")),
+		Currency:  field("currency"),
+		Timestamp: time.UnixMilli(ts).UTC(),
+		Result:    result,
+	}, nil
+}
+
+// parseClosedEntry decodes the outbox entry of a closed auction (see appendClosedLua)
+func parseClosedEntry(shard int, message redis.XMessage) (*OutboxEntry, error) {
+	fields := make(map[string]string, len(message.Values))
+	for name, value := range message.Values {
+		fields[name], _ = value.(string)
+	}
+
+	itemID := fields["item_id"]
+	item, err := parseItem(itemID, fields)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := strconv.ParseInt(fields["ts"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse close timestamp: %w", err)
+	}
+	seq, _ := strconv.ParseInt(fields["seq"], 10, 64)
+
+	return &OutboxEntry{
+		ID:        message.ID,
+		Shard:     shard,
+		Kind:      OutboxKindClosed,
+		ItemID:    itemID,
+		Currency:  item.Currency,
+		Timestamp: time.UnixMilli(ts).UTC(),
+		Item:      item,
+		Close: &CloseResult{
+			FinalPrice: parseMoney(fields["final_price"]),
+			WinnerID:   fields["winner_id"],
+			ReserveMet: fields["reserve_met"] == "1",
+			BuyNow:     fields["buy_now"] == "1",
+			Seq:        seq,
+		},
+	}, nil
+}
+
+// parseResetEntry decodes the outbox entry of a price reset (see resetPriceLua)
+func parseResetEntry(shard int, message redis.XMessage) (*OutboxEntry, error) {
+	fields := make(map[string]string, len(message.Values))
+	for name, value := range message.Values {
+		fields[name], _ = value.(string)
+	}
+
+	ts, err := strconv.ParseInt(fields["ts"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reset timestamp: %w", err)
+	}
+	seq, err := strconv.ParseInt(fields["seq"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reset seq: %w", err)
+	}
+
+	return &OutboxEntry{
+		ID:        message.ID,
+		Shard:     shard,
+		Kind:      OutboxKindReset,
+		ItemID:    fields["item_id"],
+		UserID:    fields["reset_by"],
+		Currency:  itemCurrency(fields),
+		Timestamp: time.UnixMilli(ts).UTC(),
+		Reset:     newPriceReset(fields["start_price"], fields["reset_by"], seq),
+	}, nil
+}
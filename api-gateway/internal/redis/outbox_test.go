@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestReadOutboxDeadLettersUnreadable checks that an entry that can't be parsed
+// is moved to the dead-letter stream instead of being returned or left pending
+func TestReadOutboxDeadLettersUnreadable(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, "lua")
+
+	err := client.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: outboxKey(0),
+		Values: []interface{}{"item_id", "item-1", "result", "not json"},
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := client.ReadOutbox(ctx, 0, "test", 10, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("got %d entries, want the unreadable one skipped", len(entries))
+	}
+
+	dead, err := client.client.XRange(ctx, deadLetterKey(0), "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Values["item_id"] != "item-1" || dead[0].Values["error"] == "" {
+		t.Fatalf("dead letters = %v, want the entry with its error", dead)
+	}
+	if length := client.client.XLen(ctx, outboxKey(0)).Val(); length != 0 {
+		t.Errorf("outbox still has %d entries", length)
+	}
+
+	// Moving fails when Redis does: the error reaches the relay
+	err = client.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: outboxKey(0),
+		Values: []interface{}{"item_id", "item-2", "result", "not json"},
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.client.Set(ctx, deadLetterKey(0), "not a stream", 0)
+	if _, err := client.ReadOutbox(ctx, 0, "test", 10, time.Minute, 0); err == nil {
+		t.Error("ReadOutbox succeeded although the entry couldn't be dead-lettered")
+	}
+}
@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// BidStep is one visible price change caused by a bid
+// A single bid can produce several steps when proxy bids answer it: e.g. the
+// challenger's bid followed by the leader's proxy bidding one increment above it
+type BidStep struct {
+	UserID string
+	Amount models.Money
+	Proxy  bool // Placed automatically from the user's stored maximum
+}
+
+// proxyKey returns the hash holding each bidder's secret maximum for an item
+func proxyKey(itemID string) string {
+	return fmt.Sprintf("item:%s:proxy_max", itemID)
+}
+
+// proxyBid is the state resolveBid works on
+type proxyBid struct {
+	price     models.Money // Current visible price
+	minNext   models.Money // Lowest bid accepted at the current price
+	hasBids   bool         // False until the first bid
+	leader    string       // Current highest bidder
+	leaderMax models.Money // Leader's stored maximum, at least price
+	bidder    string
+	opening   models.Money // Explicit amount of the new bid (0 for a proxy bid without one)
+	maxBid    models.Money // Maximum of a proxy bid, the amount of a plain bid
+	isProxy   bool
+}
+
+// resolveBid mirrors the proxy resolution of the bid script for the optimistic
+// strategy and returns the visible price changes; the last step holds the new
+// price and leader. The caller has checked that maxBid reaches minNext and that
+// the bidder isn't the leader raising their own maximum
+func resolveBid(fields map[string]string, bid proxyBid) []BidStep {
+	opening := bid.opening
+	if opening < bid.minNext {
+		opening = bid.minNext
+	}
+	challenged := bid.hasBids && bid.leader != bid.bidder
+
+	var steps []BidStep
+	step := func(userID string, amount models.Money, proxy bool) {
+		steps = append(steps, BidStep{UserID: userID, Amount: amount, Proxy: proxy})
+	}
+
+	if challenged && bid.leaderMax >= bid.maxBid {
+		// The leader's maximum covers this bid, their proxy answers
+		// (on a tie the earlier bidder keeps the lead at that amount)
+		answer := bid.maxBid + incrementAt(fields, bid.maxBid)
+		if answer > bid.leaderMax {
+			answer = bid.leaderMax
+		}
+		if answer > bid.maxBid {
+			step(bid.bidder, bid.maxBid, bid.isProxy)
+		}
+		step(bid.leader, answer, true)
+		return steps
+	}
+
+	if challenged && bid.leaderMax > bid.price {
+		// The displaced leader's proxy bids up to its maximum first
+		step(bid.leader, bid.leaderMax, true)
+	}
+	visible := opening
+	if bid.isProxy && challenged {
+		visible = bid.leaderMax + incrementAt(fields, bid.leaderMax)
+		if visible > bid.maxBid {
+			visible = bid.maxBid
+		}
+		if visible < opening {
+			visible = opening
+		}
+	}
+	step(bid.bidder, visible, bid.isProxy)
+	return steps
+}
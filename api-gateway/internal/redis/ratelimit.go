@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// takeTokensLua takes one token from each of several token buckets, all or none
+// Buckets refill continuously at their rate up to their burst; the clock is the
+// Redis server's, so every gateway replica sees the same buckets
+const takeTokensLua = `
+	-- KEYS[i]: ratelimit:{scope}:{id} (hash with tokens and ts, the last refill in ms)
+	-- ARGV[2i-1]: rate of bucket i (tokens per second)
+	-- ARGV[2i]: burst of bucket i (capacity)
+	--
+	-- Returns {0, 0} if a token was taken from every bucket, or
+	-- {i, retry_after_ms} for the bucket i that must refill longest before this succeeds
+
+	local clock = redis.call('TIME')
+	local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+	local tokens = {}
+	local denied, wait = 0, 0
+	for i, key in ipairs(KEYS) do
+		local rate = tonumber(ARGV[2 * i - 1])
+		local burst = tonumber(ARGV[2 * i])
+		local state = redis.call('HMGET', key, 'tokens', 'ts')
+		local available = tonumber(state[1]) or burst
+		local last = tonumber(state[2]) or now
+		available = math.min(burst, available + math.max(0, now - last) * rate / 1000)
+		tokens[i] = available
+		if available < 1 then
+			local retry = math.ceil((1 - available) * 1000 / rate)
+			if retry > wait then
+				denied, wait = i, retry
+			end
+		end
+	end
+	if denied > 0 then
+		return {denied, wait}
+	end
+
+	for i, key in ipairs(KEYS) do
+		local rate = tonumber(ARGV[2 * i - 1])
+		local burst = tonumber(ARGV[2 * i])
+		redis.call('HSET', key, 'tokens', tostring(tokens[i] - 1), 'ts', now)
+		-- A bucket left alone refills completely, after which it can be dropped
+		redis.call('PEXPIRE', key, math.ceil(burst * 1000 / rate) + 1000)
+	end
+	return {0, 0}
+`
+
+// RateBucket is one token bucket of the rate limiter
+type RateBucket struct {
+	Scope string // What the bucket limits: "user", "ip" or "item"
+	ID    string // User ID, client IP or item ID
+	Rate  int    // Tokens added per second
+	Burst int    // Capacity of the bucket
+}
+
+// rateBucketKey returns the Redis key of a token bucket
+func rateBucketKey(bucket RateBucket) string {
+	return fmt.Sprintf("ratelimit:%s:%s", bucket.Scope, bucket.ID)
+}
+
+// TakeTokens atomically takes one token from every bucket, or none if any of
+// them is empty
+// Returns the bucket that denied the request (nil if allowed) and how long it
+// needs to refill
+func (c *Client) TakeTokens(ctx context.Context, buckets []RateBucket) (*RateBucket, time.Duration, error) {
+	if len(buckets) == 0 {
+		return nil, 0, nil
+	}
+	keys := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, 2*len(buckets))
+	for _, bucket := range buckets {
+		keys = append(keys, rateBucketKey(bucket))
+		args = append(args, bucket.Rate, bucket.Burst)
+	}
+
+	result, err := c.takeTokensScript.Run(ctx, c.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to take rate limit tokens: %w", err)
+	}
+	if len(result) != 2 || result[0] < 0 || result[0] > int64(len(buckets)) {
+		return nil, 0, fmt.Errorf("unexpected rate limit script result format")
+	}
+	if result[0] == 0 {
+		return nil, 0, nil
+	}
+	return &buckets[result[0]-1], time.Duration(result[1]) * time.Millisecond, nil
+}
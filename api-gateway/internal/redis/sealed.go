@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// sealedBidsKey returns the hash holding the hidden bids of a sealed auction
+// Each value is "amount:time_ms" (amount in minor units); the time breaks ties in favour of the earlier bid
+func sealedBidsKey(itemID string) string {
+	return fmt.Sprintf("item:%s:sealed_bids", itemID)
+}
+
+// placeSealedBid mirrors the sealed branch of the bid script for the optimistic
+// strategy. It runs inside the WATCH transaction of placeBidOptimistic, after the
+// auction window was checked; rejections are returned as *bidRejectedError
+func placeSealedBid(ctx context.Context, tx *redis.Tx, fields map[string]string, itemID, userID string, amount, maxAmount models.Money, now int64, idem Idempotency) (*BidResult, error) {
+	minNext := minNextBid(fields, 0, false)
+	if maxAmount > 0 {
+		return nil, &bidRejectedError{sealed: true, reason: models.BidRejectProxyUnsupported, minNextBid: minNext, seq: itemSeq(fields)}
+	}
+
+	// A bidder may only raise their own sealed bid
+	own, err := tx.HGet(ctx, sealedBidsKey(itemID), userID).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get sealed bid: %w", err)
+	}
+	ownBid := parseSealedBid(own)
+	if amount < minNext || amount <= ownBid {
+		floor := minNext
+		if ownBid+1 > floor {
+			floor = ownBid + 1
+		}
+		return nil, &bidRejectedError{sealed: true, reason: models.BidRejectTooLow, minNextBid: floor, seq: itemSeq(fields)}
+	}
+
+	// The item hash is watched, so the count can't move before EXEC
+	bidCount, _ := strconv.ParseInt(fields["bid_count"], 10, 64)
+	endTime, _ := strconv.ParseInt(fields["end_time"], 10, 64)
+	result := &BidResult{
+		Success:    true,
+		Sealed:     true,
+		BidCount:   bidCount + 1,
+		EndTime:    time.UnixMilli(endTime).UTC(),
+		MinNextBid: minNext,
+		Seq:        itemSeq(fields) + 1,
+		RequestID:  idem.RequestID,
+		AcceptedAt: time.UnixMilli(now).UTC(),
+	}
+
+	_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sealedBidsKey(itemID), userID, fmt.Sprintf("%d:%d", amount, now))
+		pipe.HIncrBy(ctx, itemKey(itemID), "bid_count", 1)
+		pipe.HIncrBy(ctx, itemKey(itemID), "seq", 1)
+		recordBid(ctx, pipe, itemID, userID, amount, itemCurrency(fields), now, idem, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseSealedBid returns the amount of a "amount:time_ms" sealed bid (0 if empty)
+func parseSealedBid(value string) models.Money {
+	amount, _, _ := strings.Cut(value, ":")
+	return parseMoney(amount)
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aaronwang/bidding-app/api-gateway/internal/service"
+)
+
+// AuctionCloser periodically closes items whose end time has passed
+// Every gateway replica runs one; the close itself is atomic in Redis, so each
+// item is closed (and its AuctionClosedEvent published) by exactly one replica
+type AuctionCloser struct {
+	biddingService *service.BiddingService
+	interval       time.Duration
+	batchSize      int64
+}
+
+// NewAuctionCloser creates a closer polling for ended auctions every interval
+func NewAuctionCloser(biddingService *service.BiddingService, interval time.Duration, batchSize int64) *AuctionCloser {
+	return &AuctionCloser{
+		biddingService: biddingService,
+		interval:       interval,
+		batchSize:      batchSize,
+	}
+}
+
+// Run polls for ended auctions until the context is cancelled
+// This should run in a goroutine
+func (c *AuctionCloser) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.closeEndedItems(ctx)
+		}
+	}
+}
+
+// closeEndedItems closes one batch of ended auctions
+func (c *AuctionCloser) closeEndedItems(ctx context.Context) {
+	itemIDs, err := c.biddingService.GetEndedItems(ctx, c.batchSize)
+	if err != nil {
+		fmt.Printf("[CLOSER] Failed to get ended items: %v\n", err)
+		return
+	}
+
+	for _, itemID := range itemIDs {
+		_, err := c.biddingService.CloseEndedItem(ctx, itemID)
+		switch {
+		case err == nil:
+			fmt.Printf("[CLOSER] Closed ended auction %s\n", itemID)
+		case errors.Is(err, service.ErrItemClosed), errors.Is(err, service.ErrItemNotFound):
+			// Another replica (or a manual close) got there first
+		case errors.Is(err, service.ErrAuctionNotEnded):
+			// End time was extended, the item was rescheduled
+		default:
+			fmt.Printf("[CLOSER] Failed to close item %s: %v\n", itemID, err)
+		}
+	}
+}
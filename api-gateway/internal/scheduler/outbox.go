@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	redisClient "github.com/aaronwang/bidding-app/api-gateway/internal/redis"
+	"github.com/aaronwang/bidding-app/api-gateway/internal/service"
+)
+
+// Outbox relay settings
+const (
+	outboxBatchSize   = 100
+	outboxBlock       = time.Second      // Longest wait for new entries per read
+	outboxMaxBackoff  = 10 * time.Second // Longest pause after failed relays
+	outboxInitBackoff = 100 * time.Millisecond
+)
+
+// OutboxRelay drains the outbox of accepted bids and closed auctions into JetStream
+// Every gateway replica runs one, reading each shard in the same consumer group,
+// so each entry is relayed by one replica; entries of a replica that died are
+// claimed by the others once idle for retryAfter
+type OutboxRelay struct {
+	biddingService *service.BiddingService
+	consumer       string
+	retryAfter     time.Duration
+	maxDeliveries  int64
+}
+
+// NewOutboxRelay creates a relay retrying unacknowledged entries after retryAfter,
+// and dead-lettering entries still failing after maxDeliveries reads (0 never does)
+func NewOutboxRelay(biddingService *service.BiddingService, retryAfter time.Duration, maxDeliveries int) *OutboxRelay {
+	hostname, _ := os.Hostname()
+	return &OutboxRelay{
+		biddingService: biddingService,
+		consumer:       fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		retryAfter:     retryAfter,
+		maxDeliveries:  int64(maxDeliveries),
+	}
+}
+
+// Run relays every outbox shard until the context is cancelled
+// This should run in a goroutine
+func (r *OutboxRelay) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for shard := 0; shard < redisClient.OutboxShards; shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			r.relayShard(ctx, shard)
+		}(shard)
+	}
+	wg.Wait()
+}
+
+// relayShard relays one shard, backing off while relaying fails
+func (r *OutboxRelay) relayShard(ctx context.Context, shard int) {
+	backoff := outboxInitBackoff
+	for ctx.Err() == nil {
+		relayed, err := r.biddingService.RelayOutbox(ctx, shard, r.consumer, outboxBatchSize, r.retryAfter, outboxBlock, r.maxDeliveries)
+		if err == nil {
+			if relayed > 0 {
+				fmt.Printf("[OUTBOX] Relayed %d entries from shard %d\n", relayed, shard)
+			}
+			backoff = outboxInitBackoff
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		fmt.Printf("[OUTBOX] Relay of shard %d failed, retrying in %s: %v\n", shard, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > outboxMaxBackoff {
+			backoff = outboxMaxBackoff
+		}
+	}
+}
@@ -3,15 +3,20 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/aaronwang/bidding-app/shared/auth"
 	"github.com/aaronwang/bidding-app/shared/models"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 
+	"github.com/aaronwang/bidding-app/api-gateway/internal/fx"
+	"github.com/aaronwang/bidding-app/api-gateway/internal/notify"
 	redisClient "github.com/aaronwang/bidding-app/api-gateway/internal/redis"
 )
 
@@ -20,11 +25,22 @@ type BiddingService struct {
 	redis      *redisClient.Client
 	nats       *nats.Conn
 	js         jetstream.JetStream // JetStream context for persistent messaging
-	priceCache sync.Map            // Local cache for current bid prices (itemID -> float64)
+	priceCache sync.Map            // Local cache for minimum next bids (itemID -> models.Money)
+	itemMeta   sync.Map            // Local cache for the immutable item fields (itemID -> *redisClient.ItemMeta)
+	rates      fx.RateProvider     // Exchange rates for display conversion (nil disables it)
+	limits     RateLimits          // Bid rate limits per user, IP and item
+	notifier   *notify.Notifier    // Personal notifications, e.g. outbid (nil disables them)
+
+	buyNowThreshold int // Percent of the buy-now price bidding may reach before buy-now is withdrawn
 }
 
 // NewBiddingService creates a new bidding service
-func NewBiddingService(redis *redisClient.Client, natsConn *nats.Conn) (*BiddingService, error) {
+// buyNowThreshold is the percent of the buy-now price the current bid may reach
+// before buy-now is withdrawn (0 withdraws it with the first bid)
+// rates converts item amounts for display, nil disables conversion
+// limits throttles bids per user, IP and item (zero rules disable them)
+// notifier sends personal notifications, nil disables them
+func NewBiddingService(redis *redisClient.Client, natsConn *nats.Conn, buyNowThreshold int, rates fx.RateProvider, limits RateLimits, notifier *notify.Notifier) (*BiddingService, error) {
 	// Create JetStream context
 	js, err := jetstream.New(natsConn)
 	if err != nil {
@@ -39,10 +55,10 @@ func NewBiddingService(redis *redisClient.Client, natsConn *nats.Conn) (*Bidding
 		Name:        "BID_EVENTS",
 		Description: "Stream for bid events archival",
 		Subjects:    []string{"bid.events.*"},
-		Storage:     jetstream.FileStorage,  // Persistent storage
+		Storage:     jetstream.FileStorage,     // Persistent storage
 		Retention:   jetstream.WorkQueuePolicy, // Each message consumed once
-		MaxAge:      24 * time.Hour,          // Keep messages for 24 hours
-		Replicas:    1,                        // Single replica for dev
+		MaxAge:      24 * time.Hour,            // Keep messages for 24 hours
+		Replicas:    1,                         // Single replica for dev
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create/update stream: %w", err)
@@ -50,153 +66,358 @@ func NewBiddingService(redis *redisClient.Client, natsConn *nats.Conn) (*Bidding
 	fmt.Println("[JETSTREAM] Stream 'BID_EVENTS' ready")
 
 	return &BiddingService{
-		redis: redis,
-		nats:  natsConn,
-		js:    js,
+		redis:    redis,
+		nats:     natsConn,
+		js:       js,
+		rates:    rates,
+		limits:   limits,
+		notifier: notifier,
+
+		buyNowThreshold: buyNowThreshold,
 	}, nil
 }
 
 // PlaceBid handles the complete bid placement workflow:
 // 1. Validate bid (business rules)
 // 2. Pre-filter using local cache (fast rejection)
-// 3. Attempt atomic update in Redis
-// 4. If successful, publish to Redis Pub/Sub for real-time broadcast
-// 5. If successful, publish to NATS for archival
+// 3. Attempt atomic update in Redis (also checks the auction is open)
+// 4. If successful, publish to NATS for real-time broadcast
+// 5. The bid script queued the events in the outbox, relayed to JetStream for archival
+// 6. Confirm the bid to the bidder and notify the bidder it displaced, if any
+// The caller rate limits the bid first (see CheckBidRateLimit)
 func (s *BiddingService) PlaceBid(ctx context.Context, itemID string, req *models.BidRequest) (*models.BidResponse, error) {
+	// Authenticated callers always bid as themselves
+	req.UserID = callerID(ctx, req.UserID)
+
 	// Business validation
-	if req.Amount <= 0 {
+	// A proxy bid may leave Amount out, the opening bid is then the minimum next bid
+	isProxy := req.MaxAmount > 0
+	if req.Amount <= 0 && !isProxy {
 		return &models.BidResponse{
 			Success: false,
 			Message: "Bid amount must be positive",
 		}, nil
 	}
+	if isProxy && req.Amount > req.MaxAmount {
+		return &models.BidResponse{
+			Success: false,
+			Message: "Bid amount must not exceed the maximum bid",
+		}, nil
+	}
+
+	// Amounts are in the item's currency; a bid naming another currency is rejected
+	currency, err := s.itemCurrency(ctx, itemID)
+	if errors.Is(err, ErrItemNotFound) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to place bid: %w", err)
+	}
+	if req.Currency != "" && !strings.EqualFold(req.Currency, currency) {
+		return &models.BidResponse{
+			Success:  false,
+			Message:  bidRejectMessage(models.BidRejectCurrency, 0, currency),
+			YourBid:  req.Amount,
+			YourMax:  req.MaxAmount,
+			Currency: currency,
+			Reason:   models.BidRejectCurrency,
+		}, nil
+	}
+
+	// The highest amount this request can bid, used for the minimum checks
+	ceiling := req.Amount
+	if isProxy {
+		ceiling = req.MaxAmount
+	}
 
 	// Pre-filter: Check local cache before calling Redis
 	// This reduces Redis load by quickly rejecting bids that are obviously too low
-	if cachedPrice, ok := s.priceCache.Load(itemID); ok {
-		cachedValue := cachedPrice.(float64)
-		if req.Amount <= cachedValue {
+	// The cache holds the minimum acceptable next bid (current bid + increment, or start price)
+	// Retries with an idempotency key skip it: their bid may already be accepted,
+	// and only Redis has the stored result
+	if cachedMin, ok := s.priceCache.Load(itemID); ok && req.IdempotencyKey == "" {
+		cachedValue := cachedMin.(models.Money)
+		if ceiling < cachedValue {
 			// Bid appears too low based on cache, but verify with Redis
 			// This prevents stale cache from incorrectly rejecting valid bids
-			actualPrice, _, err := s.redis.GetItemBid(ctx, itemID)
+			item, err := s.redis.GetItem(ctx, itemID)
 			if err != nil {
-				// Redis error, proceed with cache value
-				fmt.Printf("[CACHE-FILTER] Redis error, using cached price: %v\n", err)
-				actualPrice = cachedValue
-			} else if actualPrice != cachedValue {
-				// Cache was stale! Update it with actual Redis value
-				fmt.Printf("[CACHE-SYNC] Cache mismatch - cached: $%.2f, actual: $%.2f, updating cache\n",
-					cachedValue, actualPrice)
-				s.priceCache.Store(itemID, actualPrice)
-			}
+				// Let the atomic bid path decide (and report unknown items)
+				fmt.Printf("[CACHE-FILTER] Redis error, skipping pre-filter: %v\n", err)
+			} else {
+				if item.MinNextBid != cachedValue {
+					// Cache was stale! Update it with actual Redis value
+					fmt.Printf("[CACHE-SYNC] Cache mismatch - cached: %s, actual: %s, updating cache\n",
+						cachedValue, item.MinNextBid)
+					s.priceCache.Store(itemID, item.MinNextBid)
+				}
 
-			// Final decision based on actual Redis price
-			if req.Amount <= actualPrice {
-				fmt.Printf("[CACHE-FILTER] Rejected bid $%.2f (current price: $%.2f) for item %s\n",
-					req.Amount, actualPrice, itemID)
-				return &models.BidResponse{
-					Success:    false,
-					Message:    fmt.Sprintf("Bid too low. Current highest bid is $%.2f", actualPrice),
-					CurrentBid: actualPrice,
-					YourBid:    req.Amount,
-					IsHighest:  false,
-				}, nil
+				// Final decision based on actual Redis state
+				if ceiling < item.MinNextBid {
+					fmt.Printf("[CACHE-FILTER] Rejected bid %s (minimum bid: %s) for item %s\n",
+						ceiling, item.MinNextBid, itemID)
+					return &models.BidResponse{
+						Success:    false,
+						Message:    bidRejectMessage(models.BidRejectTooLow, item.MinNextBid, currency),
+						CurrentBid: item.CurrentBid,
+						YourBid:    req.Amount,
+						IsHighest:  false,
+						YourMax:    req.MaxAmount,
+						MinNextBid: item.MinNextBid,
+						Currency:   currency,
+						ReserveMet: item.ReserveMet,
+						Reason:     models.BidRejectTooLow,
+						Seq:        item.Seq,
+					}, nil
+				}
+				// Bid actually reaches the minimum, continue to atomic update
 			}
-			// Bid is actually higher than Redis price, continue to atomic update
 		}
 	}
 
 	// Passed pre-filter: attempt atomic bid in Redis
-	result, err := s.redis.PlaceBid(ctx, itemID, req.UserID, req.Amount)
+	idem := redisClient.Idempotency{Key: req.IdempotencyKey, RequestID: uuid.New().String()}
+	result, err := s.redis.PlaceBid(ctx, itemID, req.UserID, req.Amount, req.MaxAmount, currency, idem)
+	if errors.Is(err, ErrIdempotencyKeyReused) {
+		return nil, ErrIdempotencyKeyReused
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to place bid: %w", err)
 	}
+	// A replayed result was published by the original request
+	publish := !result.Replayed
+	if result.Replayed {
+		fmt.Printf("[IDEMPOTENCY] Replayed bid %s of user %s on item %s\n", result.RequestID, req.UserID, itemID)
+	}
 
 	// Check if bid was successful
 	if !result.Success {
-		// Update cache with current price (even on failure, to keep cache fresh)
-		s.priceCache.Store(itemID, result.CurrentBid)
+		if result.Reason == models.BidRejectItemNotFound {
+			return nil, ErrItemNotFound
+		}
+
+		// Update cache with minimum next bid (even on failure, to keep cache fresh)
+		// A rejected sealed bid reports the bidder's own floor, which isn't shared,
+		// and the Dutch clock price keeps dropping, neither is cached
+		if !result.Sealed && !result.Dutch {
+			s.priceCache.Store(itemID, result.MinNextBid)
+		}
 
 		return &models.BidResponse{
 			Success:    false,
-			Message:    fmt.Sprintf("Bid too low. Current highest bid is $%.2f", result.CurrentBid),
+			Message:    bidRejectMessage(result.Reason, result.MinNextBid, currency),
 			CurrentBid: result.CurrentBid,
 			YourBid:    req.Amount,
 			IsHighest:  false,
+			YourMax:    req.MaxAmount,
+			MinNextBid: result.MinNextBid,
+			Currency:   currency,
+			ReserveMet: result.ReserveMet,
+			Reason:     result.Reason,
+			Seq:        result.Seq,
 		}, nil
 	}
 
-	// Update cache with new successful bid
-	s.priceCache.Store(itemID, req.Amount)
-	fmt.Printf("[CACHE-UPDATE] Updated cache for item %s: $%.2f\n", itemID, req.Amount)
+	// Update cache with the minimum next bid after this successful bid
+	// (a replayed result is stale, the price may have moved since)
+	if publish {
+		s.priceCache.Store(itemID, result.MinNextBid)
+		fmt.Printf("[CACHE-UPDATE] Updated cache for item %s: min next bid %s\n", itemID, result.MinNextBid)
+	}
+
+	// The bid's events are archived by the outbox relay: the bid script appended
+	// them to the outbox together with the bid, so they survive a crash right here
+	events := bidEvents(itemID, req.UserID, req.Amount, currency, result)
 
-	// Bid successful! Create event for downstream systems
-	bidEvent := &models.BidEvent{
-		EventID:     uuid.New().String(),
-		ItemID:      itemID,
-		BidID:       uuid.New().String(),
-		UserID:      req.UserID,
-		Amount:      req.Amount,
-		PreviousBid: result.PreviousBid,
-		Timestamp:   time.Now().UTC(),
+	// Sealed auction: the bid is only archived, watchers only learn the bid count
+	if result.Sealed {
+		if publish {
+			s.publishBroadcast(itemID, &models.BidCountEvent{
+				Type:      models.EventTypeBidCount,
+				EventID:   requestUUID(result.RequestID, "bid_count", 0),
+				ItemID:    itemID,
+				BidCount:  result.BidCount,
+				Seq:       result.Seq,
+				Timestamp: result.AcceptedAt,
+			})
+		}
+
+		response := &models.BidResponse{
+			Success:    true,
+			Message:    "Sealed bid placed, bids are revealed when the auction closes",
+			YourBid:    req.Amount,
+			MinNextBid: result.MinNextBid,
+			Currency:   currency,
+			EventID:    events[0].EventID,
+			Seq:        result.Seq,
+		}
+		if publish {
+			s.confirmBid(itemID, req, response, result)
+		}
+		return response, nil
 	}
 
-	// Publish to NATS for real-time broadcast (non-blocking, best effort)
-	// NATS is much faster than Redis Pub/Sub (~1ms vs ~40ms)
-	go func() {
-		eventJSON, err := json.Marshal(bidEvent)
-		if err != nil {
-			fmt.Printf("Warning: failed to marshal bid event for NATS: %v\n", err)
-			return
+	// The leader raised their own maximum: nothing visible changed, nothing to publish
+	if result.MaxRaised {
+		response := &models.BidResponse{
+			Success:    true,
+			Message:    "Maximum bid updated",
+			CurrentBid: result.CurrentBid,
+			YourBid:    result.CurrentBid,
+			IsHighest:  true,
+			YourMax:    req.MaxAmount,
+			MinNextBid: result.MinNextBid,
+			Currency:   currency,
+			ReserveMet: result.ReserveMet,
+			Seq:        result.Seq,
 		}
+		if publish {
+			s.confirmBid(itemID, req, response, result)
+		}
+		return response, nil
+	}
 
-		subject := fmt.Sprintf("bid_events.%s", itemID)
-		if err := s.nats.Publish(subject, eventJSON); err != nil {
-			fmt.Printf("Warning: failed to publish bid event to NATS: %v\n", err)
-		} else {
-			fmt.Printf("[NATS] Published bid event to subject: %s\n", subject)
+	// Bid successful! One event per visible price change goes to watchers right away
+	// (a proxy answering this bid shows up as its own bid event)
+	yourBid := req.Amount
+	var eventID string
+	broadcast := make([]interface{}, 0, len(events))
+	for _, bidEvent := range events {
+		if bidEvent.UserID == req.UserID {
+			yourBid = bidEvent.Amount
+			eventID = bidEvent.EventID
 		}
-	}()
+		broadcast = append(broadcast, bidEvent)
+	}
+	if publish {
+		// Publish to NATS for real-time broadcast (non-blocking), all steps in order
+		s.publishBroadcast(itemID, broadcast...)
+		s.notifyOutbid(itemID, currency, result)
+	}
+	if result.Extended && publish {
+		fmt.Printf("[SOFT-CLOSE] Bid on item %s extended end time to %s\n", itemID, result.EndTime.Format(time.RFC3339))
+	}
 
-	// Publish to NATS for archival (async, non-blocking)
-	// This demonstrates the key architectural principle: write path doesn't depend on archival
-	go func() {
-		if err := s.publishToArchivalQueue(bidEvent); err != nil {
-			// Log error but don't fail the bid
-			fmt.Printf("Warning: failed to publish to archival queue: %v\n", err)
+	isHighest := result.HighestBidder == req.UserID
+	message := "Bid placed successfully!"
+	if result.Dutch {
+		// The bid took the Dutch clock price: the auction is won and closed (the bid
+		// script queued the close in the outbox after the bid)
+		if publish {
+			s.finalizeClose(ctx, itemID, &redisClient.CloseResult{
+				FinalPrice: result.CurrentBid,
+				WinnerID:   req.UserID,
+				ReserveMet: true,
+				Seq:        result.CloseSeq,
+			}, result.AcceptedAt)
 		}
-	}()
+		message = fmt.Sprintf("You won the auction at the clock price of %s %s", result.CurrentBid, currency)
+	} else if !isHighest {
+		fmt.Printf("[PROXY] Bid %s on item %s answered by proxy of %s at %s\n",
+			yourBid, itemID, result.HighestBidder, result.CurrentBid)
+		message = "Bid placed, but another bidder's maximum bid is higher"
+	}
 
-	return &models.BidResponse{
+	response := &models.BidResponse{
 		Success:    true,
-		Message:    "Bid placed successfully!",
-		CurrentBid: req.Amount,
-		YourBid:    req.Amount,
-		IsHighest:  true,
-		EventID:    bidEvent.EventID,
-	}, nil
+		Message:    message,
+		CurrentBid: result.CurrentBid,
+		YourBid:    yourBid,
+		IsHighest:  isHighest,
+		YourMax:    req.MaxAmount,
+		MinNextBid: result.MinNextBid,
+		Currency:   currency,
+		ReserveMet: result.ReserveMet,
+		EventID:    eventID,
+		Seq:        result.Seq,
+	}
+	if publish {
+		s.confirmBid(itemID, req, response, result)
+	}
+	return response, nil
+}
+
+// bidRejectMessage returns the user-facing message for a bid rejection reason
+func bidRejectMessage(reason string, minNextBid models.Money, currency string) string {
+	switch reason {
+	case models.BidRejectAuctionClosed:
+		return "Auction is closed"
+	case models.BidRejectNotStarted:
+		return "Auction has not started yet"
+	case models.BidRejectEnded:
+		return "Auction has ended"
+	case models.BidRejectProxyUnsupported:
+		return "Proxy bidding is not available for this auction type"
+	case models.BidRejectCurrency:
+		return fmt.Sprintf("Bids on this item must be in %s", currency)
+	default:
+		return fmt.Sprintf("Bid too low. Minimum acceptable bid is %s %s", minNextBid, currency)
+	}
+}
+
+// requestUUID derives the ID of the i-th event (or bid) of a bid request, so that
+// a result replayed for an idempotency key reports the IDs of the original request
+func requestUUID(requestID, kind string, i int) string {
+	return uuid.NewSHA1(uuid.MustParse(requestID), []byte(fmt.Sprintf("%s:%d", kind, i))).String()
+}
+
+// callerID returns the authenticated caller's user ID, or userID from the
+// request body when authentication is disabled
+func callerID(ctx context.Context, userID string) string {
+	if claims, ok := auth.FromContext(ctx); ok {
+		return claims.Subject
+	}
+	return userID
 }
 
-// GetItemBid retrieves the current highest bid for an item
-func (s *BiddingService) GetItemBid(ctx context.Context, itemID string) (*models.Item, error) {
-	bid, bidderID, err := s.redis.GetItemBid(ctx, itemID)
+// itemCurrency returns the currency of an item's amounts
+func (s *BiddingService) itemCurrency(ctx context.Context, itemID string) (string, error) {
+	meta, err := s.getItemMeta(ctx, itemID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get item bid: %w", err)
+		return "", err
 	}
+	return meta.Currency, nil
+}
 
-	// In a real system, you'd fetch full item details from a cache or database
-	// For this demo, we return minimal info
-	return &models.Item{
-		ID:              itemID,
-		CurrentBid:      bid,
-		HighestBidderID: bidderID,
-		Status:          models.ItemStatusActive,
-	}, nil
+// getItemMeta returns the immutable fields of an item, cached after the first lookup
+func (s *BiddingService) getItemMeta(ctx context.Context, itemID string) (*redisClient.ItemMeta, error) {
+	if meta, ok := s.itemMeta.Load(itemID); ok {
+		return meta.(*redisClient.ItemMeta), nil
+	}
+	meta, err := s.redis.GetItemMeta(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	s.itemMeta.Store(itemID, meta)
+	return meta, nil
+}
+
+// publishBroadcast publishes events to NATS for real-time broadcast (non-blocking, best effort)
+// NATS is much faster than Redis Pub/Sub (~1ms vs ~40ms)
+// The events are published in order from one goroutine, so the steps of one bid
+// reach the broadcast service in sequence order instead of being dropped as stale
+func (s *BiddingService) publishBroadcast(itemID string, events ...interface{}) {
+	go func() {
+		subject := fmt.Sprintf("bid_events.%s", itemID)
+		for _, event := range events {
+			eventJSON, err := json.Marshal(event)
+			if err != nil {
+				fmt.Printf("Warning: failed to marshal event for NATS: %v\n", err)
+				continue
+			}
+
+			if err := s.nats.Publish(subject, eventJSON); err != nil {
+				fmt.Printf("Warning: failed to publish event to NATS: %v\n", err)
+			} else {
+				fmt.Printf("[NATS] Published event to subject: %s\n", subject)
+			}
+		}
+	}()
 }
 
-// publishToArchivalQueue publishes bid event to NATS JetStream for archival persistence
+// publishToArchivalQueue publishes an item event to NATS JetStream for archival persistence
 // Uses JetStream for guaranteed delivery (at-least-once semantics)
-func (s *BiddingService) publishToArchivalQueue(event *models.BidEvent) error {
+func (s *BiddingService) publishToArchivalQueue(itemID string, event interface{}, opts ...jetstream.PublishOpt) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
@@ -204,14 +425,14 @@ func (s *BiddingService) publishToArchivalQueue(event *models.BidEvent) error {
 
 	// Publish to JetStream subject
 	// Subject naming: "bid.events.{itemID}" allows for future routing/filtering
-	subject := fmt.Sprintf("bid.events.%s", event.ItemID)
+	subject := fmt.Sprintf("bid.events.%s", itemID)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// JetStream Publish waits for acknowledgment from server
 	// This ensures the message is persisted before returning
-	ack, err := s.js.Publish(ctx, subject, data)
+	ack, err := s.js.Publish(ctx, subject, data, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to publish to JetStream: %w", err)
 	}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/nats-io/nats.go"
+)
+
+// clockRequestSubject is the NATS request/reply subject the broadcast service uses
+// to look up the Dutch clock of an item when its first watcher connects
+const clockRequestSubject = "items.clock.*"
+
+// ServeClockRequests answers Dutch clock lookups from the broadcast service
+// Every gateway replica subscribes in the same queue group, so each request is
+// answered once
+func (s *BiddingService) ServeClockRequests() (*nats.Subscription, error) {
+	sub, err := s.nats.QueueSubscribe(clockRequestSubject, "api-gateway", func(msg *nats.Msg) {
+		itemID := strings.TrimPrefix(msg.Subject, "items.clock.")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		event := &models.DutchClockEvent{Type: models.EventTypeDutchClock, ItemID: itemID}
+		if item, err := s.redis.GetItem(ctx, itemID); err == nil && item.Status != models.ItemStatusClosed {
+			event = clockEvent(item)
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			fmt.Printf("Warning: failed to marshal clock of item %s: %v\n", itemID, err)
+			return
+		}
+		if err := msg.Respond(data); err != nil {
+			fmt.Printf("Warning: failed to answer clock request for item %s: %v\n", itemID, err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to clock requests: %w", err)
+	}
+	return sub, nil
+}
+
+// announceClock tells the broadcast service about a created or rescheduled item,
+// so price ticks for Dutch auctions start (or stop) without waiting for a lookup
+func (s *BiddingService) announceClock(item *models.Item) {
+	s.publishBroadcast(item.ID, clockEvent(item))
+}
+
+// clockEvent returns the Dutch clock of an item (without a rule if it isn't a Dutch auction)
+func clockEvent(item *models.Item) *models.DutchClockEvent {
+	event := &models.DutchClockEvent{
+		Type:       models.EventTypeDutchClock,
+		ItemID:     item.ID,
+		StartPrice: item.StartPrice,
+		Currency:   item.Currency,
+		StartTime:  item.StartTime,
+		EndTime:    item.EndTime,
+	}
+	if item.AuctionType == models.AuctionTypeDutch {
+		event.Dutch = item.Dutch
+	}
+	return event
+}
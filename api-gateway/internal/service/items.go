@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/google/uuid"
+
+	"github.com/aaronwang/bidding-app/api-gateway/internal/fx"
+	redisClient "github.com/aaronwang/bidding-app/api-gateway/internal/redis"
+)
+
+// Item lifecycle errors, checked by the HTTP handlers with errors.Is
+var (
+	ErrInvalidItem  = errors.New("invalid item")
+	ErrItemNotFound = redisClient.ErrItemNotFound
+	ErrItemExists   = redisClient.ErrItemExists
+	ErrItemClosed   = redisClient.ErrItemClosed
+
+	ErrAuctionNotEnded = redisClient.ErrAuctionNotEnded
+	ErrAuctionStarted  = redisClient.ErrAuctionStarted
+
+	ErrAuctionNotOpen    = redisClient.ErrAuctionNotOpen
+	ErrBuyNowUnavailable = redisClient.ErrBuyNowUnavailable
+
+	ErrDisplayCurrency = errors.New("display currency not available")
+
+	ErrIdempotencyKeyReused = redisClient.ErrIdempotencyKeyReused
+)
+
+// idPattern restricts item and user IDs to characters that are safe in Redis
+// keys, NATS subjects (no '.', '*' or '>') and mail headers (no CR/LF)
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// CreateItem validates and persists a new auction item
+func (s *BiddingService) CreateItem(ctx context.Context, req *models.CreateItemRequest) (*models.Item, error) {
+	now := time.Now().UTC()
+
+	item := &models.Item{
+		ID:          req.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		StartPrice:  req.StartPrice,
+		Currency:    strings.ToUpper(req.Currency),
+		SellerID:    callerID(ctx, req.SellerID),
+		Status:      models.ItemStatusActive,
+		StartTime:   req.StartTime.UTC(),
+		EndTime:     req.EndTime.UTC(),
+		AuctionType: req.AuctionType,
+		SoftClose:   req.SoftClose,
+		Dutch:       req.Dutch,
+		CreatedAt:   now,
+
+		MinIncrement:   req.MinIncrement,
+		IncrementTiers: req.IncrementTiers,
+		ReservePrice:   req.ReservePrice,
+		BuyNowPrice:    req.BuyNowPrice,
+		UpdatedAt:      now,
+	}
+	if item.ID == "" {
+		item.ID = uuid.New().String()
+	}
+	if item.AuctionType == "" {
+		item.AuctionType = models.AuctionTypeEnglish
+	}
+	if item.Currency == "" {
+		item.Currency = models.DefaultCurrency
+	}
+	if req.StartTime.IsZero() {
+		item.StartTime = now
+	}
+
+	if err := validateItem(item); err != nil {
+		return nil, err
+	}
+	if !models.ValidCurrency(item.Currency) {
+		return nil, fmt.Errorf("%w: currency must be a 3-letter ISO 4217 code", ErrInvalidItem)
+	}
+	if !item.EndTime.After(now) {
+		return nil, fmt.Errorf("%w: end_time must be in the future", ErrInvalidItem)
+	}
+
+	if err := s.redis.CreateItem(ctx, item); err != nil {
+		return nil, err
+	}
+	fmt.Printf("[ITEM] Created item %s (%s), open %s - %s\n",
+		item.ID, item.Name, item.StartTime.Format(time.RFC3339), item.EndTime.Format(time.RFC3339))
+	if item.AuctionType == models.AuctionTypeDutch {
+		s.announceClock(item)
+	}
+
+	return s.withEffectiveStatus(item, now), nil
+}
+
+// UpdateItem applies a partial update to an item that hasn't been closed yet
+func (s *BiddingService) UpdateItem(ctx context.Context, itemID string, req *models.UpdateItemRequest) (*models.Item, error) {
+	item, err := s.redis.GetItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status == models.ItemStatusClosed {
+		return nil, ErrItemClosed
+	}
+
+	now := time.Now().UTC()
+
+	if req.Name != nil {
+		item.Name = *req.Name
+	}
+	if req.Description != nil {
+		item.Description = *req.Description
+	}
+	scheduleChanged := false
+	if req.StartPrice != nil {
+		item.StartPrice = *req.StartPrice
+		scheduleChanged = true
+	}
+	if req.StartTime != nil {
+		item.StartTime = req.StartTime.UTC()
+		scheduleChanged = true
+	}
+	if req.EndTime != nil {
+		item.EndTime = req.EndTime.UTC()
+		scheduleChanged = true
+	}
+	if req.AuctionType != nil {
+		item.AuctionType = *req.AuctionType
+		if item.AuctionType != models.AuctionTypeDutch {
+			item.Dutch = nil
+		}
+		scheduleChanged = true
+	}
+	if req.SoftClose != nil {
+		item.SoftClose = req.SoftClose
+		scheduleChanged = true
+	}
+	if req.Dutch != nil {
+		item.Dutch = req.Dutch
+		scheduleChanged = true
+	}
+	if req.MinIncrement != nil {
+		item.MinIncrement = *req.MinIncrement
+		scheduleChanged = true
+	}
+	if req.IncrementTiers != nil {
+		item.IncrementTiers = req.IncrementTiers
+		scheduleChanged = true
+	}
+	if req.ReservePrice != nil {
+		item.ReservePrice = *req.ReservePrice
+		scheduleChanged = true
+	}
+	if req.BuyNowPrice != nil {
+		item.BuyNowPrice = *req.BuyNowPrice
+		scheduleChanged = true
+	}
+	item.UpdatedAt = now
+
+	if err := validateItem(item); err != nil {
+		return nil, err
+	}
+
+	if err := s.redis.UpdateItem(ctx, item, scheduleChanged, now); err != nil {
+		return nil, err
+	}
+	fmt.Printf("[ITEM] Updated item %s\n", itemID)
+	if scheduleChanged {
+		s.announceClock(item)
+	}
+
+	return s.withEffectiveStatus(item, now), nil
+}
+
+// CloseItem closes an auction immediately so that no further bids are accepted
+func (s *BiddingService) CloseItem(ctx context.Context, itemID string) (*models.Item, error) {
+	now := time.Now().UTC()
+
+	result, err := s.redis.CloseItem(ctx, itemID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finalizeClose(ctx, itemID, result, now)
+}
+
+// CloseEndedItem closes an auction whose end time has passed
+// Safe to call from several gateway replicas: only one of them gets past the
+// atomic close in Redis, the others get ErrItemClosed
+func (s *BiddingService) CloseEndedItem(ctx context.Context, itemID string) (*models.Item, error) {
+	now := time.Now().UTC()
+
+	result, err := s.redis.CloseEndedItem(ctx, itemID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finalizeClose(ctx, itemID, result, now)
+}
+
+// BuyNow wins an item for the user at its buy-now price and closes the auction
+// Rejected with ErrBuyNowUnavailable if the item has no buy-now price or bidding
+// already reached the configured threshold
+func (s *BiddingService) BuyNow(ctx context.Context, itemID string, req *models.BuyNowRequest) (*models.Item, error) {
+	now := time.Now().UTC()
+
+	result, err := s.redis.BuyNow(ctx, itemID, callerID(ctx, req.UserID), s.buyNowThreshold, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finalizeClose(ctx, itemID, result, now)
+}
+
+// ResetPrice discards all bids on an open item so that bidding restarts at its
+// start price, and publishes a PriceResetEvent for watchers; the reset script
+// queued the same event in the outbox, from which the relay delivers it to the
+// archival worker
+func (s *BiddingService) ResetPrice(ctx context.Context, itemID string) (*models.Item, error) {
+	now := time.Now().UTC()
+
+	reset, err := s.redis.ResetPrice(ctx, itemID, callerID(ctx, ""), now)
+	if err != nil {
+		return nil, err
+	}
+	s.priceCache.Delete(itemID)
+
+	item, err := s.GetItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishBroadcast(itemID, priceResetEvent(itemID, item.Currency, reset, now))
+	fmt.Printf("[ADMIN] Reset price of item %s to %s %s\n", itemID, item.StartPrice, item.Currency)
+
+	return item, nil
+}
+
+// ItemSeller returns the user ID of the seller of an item (empty if it has none)
+// Returns ErrItemNotFound if the item doesn't exist
+func (s *BiddingService) ItemSeller(ctx context.Context, itemID string) (string, error) {
+	meta, err := s.getItemMeta(ctx, itemID)
+	if err != nil {
+		return "", err
+	}
+	return meta.SellerID, nil
+}
+
+// GetEndedItems returns up to limit IDs of items whose auction has ended but not been closed
+func (s *BiddingService) GetEndedItems(ctx context.Context, limit int64) ([]string, error) {
+	return s.redis.GetEndedItems(ctx, time.Now(), limit)
+}
+
+// finalizeClose publishes the AuctionClosedEvent of an item that was just closed
+// in Redis to the broadcast service; the script that closed it (close, buy-now or
+// a Dutch win) queued the same event in the outbox, from which the relay delivers
+// it to the archival worker
+func (s *BiddingService) finalizeClose(ctx context.Context, itemID string, result *redisClient.CloseResult, closedAt time.Time) (*models.Item, error) {
+	s.priceCache.Delete(itemID)
+
+	item, err := s.redis.GetItem(ctx, itemID)
+	if err != nil {
+		// The auction is closed either way, publish the result we already have
+		fmt.Printf("Warning: failed to load closed item %s: %v\n", itemID, err)
+		item = &models.Item{
+			ID:              itemID,
+			CurrentBid:      result.FinalPrice,
+			Currency:        models.DefaultCurrency,
+			HighestBidderID: result.WinnerID,
+			WinnerID:        result.WinnerID,
+			Status:          models.ItemStatusClosed,
+		}
+	}
+
+	event := auctionClosedEvent(item, result, closedAt)
+	s.publishBroadcast(itemID, event)
+	s.notifyAuctionResult(ctx, event)
+
+	if result.BuyNow {
+		fmt.Printf("[ITEM] Closed item %s, bought now by %s at %s %s\n", itemID, result.WinnerID, result.FinalPrice, item.Currency)
+	} else if result.WinnerID != "" {
+		fmt.Printf("[ITEM] Closed item %s, winner %s at %s %s\n", itemID, result.WinnerID, result.FinalPrice, item.Currency)
+	} else if result.FinalPrice > 0 {
+		fmt.Printf("[ITEM] Closed item %s, reserve not met (highest bid %s %s)\n", itemID, result.FinalPrice, item.Currency)
+	} else {
+		fmt.Printf("[ITEM] Closed item %s without bids\n", itemID)
+	}
+
+	return item, nil
+}
+
+// GetItem retrieves an item with its current highest bid
+func (s *BiddingService) GetItem(ctx context.Context, itemID string) (*models.Item, error) {
+	item, err := s.redis.GetItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	return s.withEffectiveStatus(item, time.Now()), nil
+}
+
+// GetItemInCurrency retrieves an item like GetItem, with its public amounts
+// also converted to displayCurrency
+// Returns ErrDisplayCurrency if no rate provider is configured or it has no rate
+func (s *BiddingService) GetItemInCurrency(ctx context.Context, itemID, displayCurrency string) (*models.Item, error) {
+	item, err := s.GetItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if s.rates == nil {
+		return nil, fmt.Errorf("%w: currency conversion is not configured", ErrDisplayCurrency)
+	}
+
+	rate, err := s.rates.Rate(ctx, item.Currency, displayCurrency)
+	if errors.Is(err, fx.ErrRateUnavailable) {
+		return nil, fmt.Errorf("%w: %v", ErrDisplayCurrency, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	item.Display = &models.DisplayAmounts{
+		Currency:    displayCurrency,
+		Rate:        rate,
+		StartPrice:  fx.Convert(item.StartPrice, rate),
+		CurrentBid:  fx.Convert(item.CurrentBid, rate),
+		MinNextBid:  fx.Convert(item.MinNextBid, rate),
+		BuyNowPrice: fx.Convert(item.BuyNowPrice, rate),
+		ClockPrice:  fx.Convert(item.ClockPrice, rate),
+	}
+	return item, nil
+}
+
+// validateItem checks the business rules shared by create and update
+func validateItem(item *models.Item) error {
+	if !idPattern.MatchString(item.ID) {
+		return fmt.Errorf("%w: id must be 1-64 letters, digits, '-' or '_'", ErrInvalidItem)
+	}
+	if item.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidItem)
+	}
+	if strings.IndexFunc(item.Name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: name must not contain control characters", ErrInvalidItem)
+	}
+	if item.StartPrice < 0 {
+		return fmt.Errorf("%w: start_price must not be negative", ErrInvalidItem)
+	}
+	if item.EndTime.IsZero() {
+		return fmt.Errorf("%w: end_time is required", ErrInvalidItem)
+	}
+	if !item.EndTime.After(item.StartTime) {
+		return fmt.Errorf("%w: end_time must be after start_time", ErrInvalidItem)
+	}
+	if item.MinIncrement < 0 || item.ReservePrice < 0 {
+		return fmt.Errorf("%w: min_increment and reserve_price must not be negative", ErrInvalidItem)
+	}
+	if item.BuyNowPrice < 0 {
+		return fmt.Errorf("%w: buy_now_price must not be negative", ErrInvalidItem)
+	}
+	if item.BuyNowPrice > 0 && (item.BuyNowPrice < item.StartPrice || item.BuyNowPrice < item.ReservePrice) {
+		return fmt.Errorf("%w: buy_now_price must not be below start_price or reserve_price", ErrInvalidItem)
+	}
+	switch item.AuctionType {
+	case models.AuctionTypeEnglish, models.AuctionTypeSealedFirstPrice, models.AuctionTypeSealedSecondPrice, models.AuctionTypeDutch:
+	default:
+		return fmt.Errorf("%w: unknown auction_type %q", ErrInvalidItem, item.AuctionType)
+	}
+	if item.AuctionType == models.AuctionTypeDutch {
+		rule := item.Dutch
+		if rule == nil || rule.DecrementAmount <= 0 || rule.DecrementIntervalSeconds <= 0 {
+			return fmt.Errorf("%w: dutch auctions need a positive dutch.decrement_amount and dutch.decrement_interval_seconds", ErrInvalidItem)
+		}
+		if rule.FloorPrice < 0 || rule.FloorPrice > item.StartPrice || item.StartPrice <= 0 {
+			return fmt.Errorf("%w: dutch.floor_price must be between 0 and a positive start_price", ErrInvalidItem)
+		}
+		if item.SoftClose != nil || item.BuyNowPrice > 0 || item.ReservePrice > 0 || item.MinIncrement > 0 || len(item.IncrementTiers) > 0 {
+			return fmt.Errorf("%w: dutch auctions don't support soft_close, buy_now_price, reserve_price or increments", ErrInvalidItem)
+		}
+	} else if item.Dutch != nil {
+		return fmt.Errorf("%w: dutch is only valid for dutch auctions", ErrInvalidItem)
+	}
+	if models.IsSealed(item.AuctionType) {
+		if item.SoftClose != nil || item.BuyNowPrice > 0 || item.MinIncrement > 0 || len(item.IncrementTiers) > 0 {
+			return fmt.Errorf("%w: sealed auctions don't support soft_close, buy_now_price or increments", ErrInvalidItem)
+		}
+	}
+	if item.MinIncrement > 0 && len(item.IncrementTiers) > 0 {
+		return fmt.Errorf("%w: use either min_increment or increment_tiers", ErrInvalidItem)
+	}
+	for i, tier := range item.IncrementTiers {
+		if tier.From < 0 || tier.Increment <= 0 {
+			return fmt.Errorf("%w: increment_tiers need a non-negative from and a positive increment", ErrInvalidItem)
+		}
+		if i > 0 && tier.From <= item.IncrementTiers[i-1].From {
+			return fmt.Errorf("%w: increment_tiers must be sorted by from", ErrInvalidItem)
+		}
+	}
+	if rule := item.SoftClose; rule != nil {
+		if rule.WindowSeconds < 0 || rule.ExtensionSeconds < 0 || rule.MaxExtensionSeconds < 0 {
+			return fmt.Errorf("%w: soft_close values must not be negative", ErrInvalidItem)
+		}
+		if rule.WindowSeconds > 0 && rule.ExtensionSeconds == 0 {
+			return fmt.Errorf("%w: soft_close.extension_seconds is required with a window", ErrInvalidItem)
+		}
+	}
+	return nil
+}
+
+// withEffectiveStatus reports active items whose StartTime hasn't been reached as
+// scheduled and whether buy-now is still available
+func (s *BiddingService) withEffectiveStatus(item *models.Item, now time.Time) *models.Item {
+	if item.Status == models.ItemStatusActive && now.Before(item.StartTime) {
+		item.Status = models.ItemStatusScheduled
+	}
+	item.BuyNowAvailable = redisClient.BuyNowAvailable(item, s.buyNowThreshold, now)
+	return item
+}
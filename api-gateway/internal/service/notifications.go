@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+
+	"github.com/aaronwang/bidding-app/api-gateway/internal/notify"
+	redisClient "github.com/aaronwang/bidding-app/api-gateway/internal/redis"
+)
+
+// notifyOutbid tells the bidder an accepted bid displaced that they were outbid
+func (s *BiddingService) notifyOutbid(itemID, currency string, result *redisClient.BidResult) {
+	if s.notifier == nil || result.OutbidUserID == "" {
+		return
+	}
+
+	event := &models.OutbidEvent{
+		Type:       models.EventTypeOutbid,
+		EventID:    requestUUID(result.RequestID, "outbid", 0),
+		UserID:     result.OutbidUserID,
+		ItemID:     itemID,
+		CurrentBid: result.CurrentBid,
+		MinNextBid: result.MinNextBid,
+		Currency:   currency,
+		EndTime:    result.EndTime,
+		Seq:        result.Seq,
+		Timestamp:  result.AcceptedAt,
+	}
+	s.notifier.Notify(&notify.Notification{
+		ID:      event.EventID,
+		UserID:  event.UserID,
+		Subject: fmt.Sprintf("You've been outbid on item %s", itemID),
+		Text: fmt.Sprintf("Another bidder took the lead on item %s at %s %s.\nBid at least %s %s before %s to get it back.",
+			itemID, event.CurrentBid, currency, event.MinNextBid, currency, event.EndTime.Format("2006-01-02 15:04 MST")),
+		Event: event,
+	})
+	fmt.Printf("[NOTIFY] User %s outbid on item %s at %s\n", event.UserID, itemID, event.CurrentBid)
+}
+
+// confirmBid sends the bidder a confirmation of their accepted bid
+func (s *BiddingService) confirmBid(itemID string, req *models.BidRequest, response *models.BidResponse, result *redisClient.BidResult) {
+	s.publishUserEvent(req.UserID, &models.BidConfirmedEvent{
+		Type:       models.EventTypeBidConfirmed,
+		EventID:    requestUUID(result.RequestID, "bid_confirmed", 0),
+		UserID:     req.UserID,
+		ItemID:     itemID,
+		YourBid:    response.YourBid,
+		YourMax:    req.MaxAmount,
+		CurrentBid: response.CurrentBid,
+		IsHighest:  response.IsHighest,
+		Currency:   response.Currency,
+		Sealed:     result.Sealed,
+		Seq:        result.Seq,
+		Timestamp:  result.AcceptedAt,
+	})
+}
+
+// notifyAuctionResult tells every bidder of a closed auction whether they won
+// The winner is notified on all channels; the other bidders, possibly many,
+// only get the live event on their WebSocket connections
+func (s *BiddingService) notifyAuctionResult(ctx context.Context, closed *models.AuctionClosedEvent) {
+	bidders, err := s.redis.GetBidders(ctx, closed.ItemID)
+	if err != nil {
+		fmt.Printf("Warning: failed to notify the bidders of item %s: %v\n", closed.ItemID, err)
+	}
+
+	result := func(eventType, userID string) *models.AuctionResultEvent {
+		return &models.AuctionResultEvent{
+			Type:       eventType,
+			EventID:    requestUUID(closed.EventID, eventType+":"+userID, 0),
+			UserID:     userID,
+			ItemID:     closed.ItemID,
+			Name:       closed.Name,
+			FinalPrice: closed.FinalPrice,
+			Currency:   closed.Currency,
+			ReserveMet: closed.ReserveMet,
+			BuyNow:     closed.BuyNow,
+			ClosedAt:   closed.ClosedAt,
+		}
+	}
+
+	if closed.WinnerID != "" {
+		event := result(models.EventTypeAuctionWon, closed.WinnerID)
+		if s.notifier != nil {
+			s.notifier.Notify(&notify.Notification{
+				ID:      event.EventID,
+				UserID:  event.UserID,
+				Subject: fmt.Sprintf("You won %s", closed.Name),
+				Text: fmt.Sprintf("You won the auction of %s (item %s) at %s %s.",
+					closed.Name, closed.ItemID, closed.FinalPrice, closed.Currency),
+				Event: event,
+			})
+		} else {
+			s.publishUserEvent(closed.WinnerID, event)
+		}
+	}
+	for _, bidder := range bidders {
+		if bidder != closed.WinnerID {
+			s.publishUserEvent(bidder, result(models.EventTypeAuctionLost, bidder))
+		}
+	}
+}
+
+// publishUserEvent publishes a personal event on user_events.{userID}, which the
+// broadcast service forwards to the user's WebSocket connections (non-blocking, best effort)
+// User IDs outside idPattern are not published, as they could address other subjects
+func (s *BiddingService) publishUserEvent(userID string, event interface{}) {
+	if !idPattern.MatchString(userID) {
+		fmt.Printf("Warning: not publishing user event to invalid user ID %q\n", userID)
+		return
+	}
+	go func() {
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			fmt.Printf("Warning: failed to marshal user event: %v\n", err)
+			return
+		}
+		if err := s.nats.Publish(fmt.Sprintf("user_events.%s", userID), eventJSON); err != nil {
+			fmt.Printf("Warning: failed to publish user event: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+
+	redisClient "github.com/aaronwang/bidding-app/api-gateway/internal/redis"
+)
+
+// bidEvents returns the events of an accepted bid: one per visible price change,
+// or the archive-only event of a sealed bid
+// Everything is derived from the bid's result and request ID, so PlaceBid and the
+// outbox relay produce the same events (and IDs) for the same bid
+func bidEvents(itemID, userID string, amount models.Money, currency string, result *redisClient.BidResult) []*models.BidEvent {
+	if result.Sealed {
+		return []*models.BidEvent{{
+			Type:      models.EventTypeBid,
+			EventID:   requestUUID(result.RequestID, "event", 0),
+			ItemID:    itemID,
+			BidID:     requestUUID(result.RequestID, "bid", 0),
+			UserID:    userID,
+			Amount:    amount,
+			Currency:  currency,
+			Timestamp: result.AcceptedAt,
+			EndTime:   result.EndTime,
+			Sealed:    true,
+			Seq:       result.Seq,
+		}}
+	}
+
+	events := make([]*models.BidEvent, 0, len(result.Steps))
+	previousBid := result.PreviousBid
+	// result.Seq is the sequence number of the last step
+	firstSeq := result.Seq - int64(len(result.Steps)) + 1
+	for i, step := range result.Steps {
+		events = append(events, &models.BidEvent{
+			Type:            models.EventTypeBid,
+			EventID:         requestUUID(result.RequestID, "event", i),
+			ItemID:          itemID,
+			BidID:           requestUUID(result.RequestID, "bid", i),
+			UserID:          step.UserID,
+			Amount:          step.Amount,
+			PreviousBid:     previousBid,
+			Currency:        currency,
+			Timestamp:       result.AcceptedAt,
+			EndTime:         result.EndTime,
+			EndTimeExtended: result.Extended && i == len(result.Steps)-1,
+			Proxy:           step.Proxy,
+			Seq:             firstSeq + int64(i),
+		})
+		if i == len(result.Steps)-1 {
+			events[i].OutbidUserID = result.OutbidUserID
+		}
+		previousBid = step.Amount
+	}
+	return events
+}
+
+// auctionClosedEvent returns the AuctionClosedEvent of an item closed with result
+// Its event ID derives from the item ID (an item closes once), so finalizeClose
+// and the outbox relay produce the same event
+func auctionClosedEvent(item *models.Item, result *redisClient.CloseResult, closedAt time.Time) *models.AuctionClosedEvent {
+	return &models.AuctionClosedEvent{
+		Type:        models.EventTypeAuctionClosed,
+		EventID:     uuid.NewSHA1(uuid.NameSpaceURL, []byte("auction_closed:"+item.ID)).String(),
+		ItemID:      item.ID,
+		Name:        item.Name,
+		Description: item.Description,
+		StartPrice:  item.StartPrice,
+		StartTime:   item.StartTime,
+		EndTime:     item.EndTime,
+		AuctionType: item.AuctionType,
+		WinnerID:    result.WinnerID,
+		FinalPrice:  result.FinalPrice,
+		Currency:    item.Currency,
+		ReserveMet:  result.ReserveMet,
+		BuyNow:      result.BuyNow,
+		ClosedAt:    closedAt.UTC(),
+		Seq:         result.Seq,
+	}
+}
+
+// priceResetEvent returns the PriceResetEvent of a price reset at resetAt
+// Its event ID derives from the item ID and the reset's sequence number, so
+// ResetPrice and the outbox relay produce the same event
+func priceResetEvent(itemID, currency string, reset *redisClient.PriceReset, resetAt time.Time) *models.PriceResetEvent {
+	return &models.PriceResetEvent{
+		Type:       models.EventTypePriceReset,
+		EventID:    uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("price_reset:%s:%d", itemID, reset.Seq))).String(),
+		ItemID:     itemID,
+		StartPrice: reset.StartPrice,
+		MinNextBid: reset.MinNextBid,
+		Currency:   currency,
+		ResetBy:    reset.ResetBy,
+		Seq:        reset.Seq,
+		Timestamp:  resetAt.UTC(),
+	}
+}
+
+// outboxEvents returns the events to relay for an outbox entry
+func outboxEvents(entry *redisClient.OutboxEntry) []interface{} {
+	switch entry.Kind {
+	case redisClient.OutboxKindClosed:
+		return []interface{}{auctionClosedEvent(entry.Item, entry.Close, entry.Timestamp)}
+	case redisClient.OutboxKindReset:
+		return []interface{}{priceResetEvent(entry.ItemID, entry.Currency, entry.Reset, entry.Timestamp)}
+	}
+	entry.Result.AcceptedAt = entry.Timestamp
+	bids := bidEvents(entry.ItemID, entry.UserID, entry.Amount, entry.Currency, entry.Result)
+	events := make([]interface{}, len(bids))
+	for i, event := range bids {
+		events[i] = event
+	}
+	return events
+}
+
+// outboxMetrics counts the relay's outcomes, published at /debug/vars:
+// "relayed" and "dead_lettered" entries
+var outboxMetrics = expvar.NewMap("outbox")
+
+// EnsureOutbox prepares the outbox streams for the relay
+func (s *BiddingService) EnsureOutbox(ctx context.Context) error {
+	return s.redis.EnsureOutbox(ctx)
+}
+
+// RelayOutbox relays one batch of accepted bids, closed auctions and price
+// resets from an outbox shard to JetStream
+// An entry is acknowledged only after JetStream acknowledged all of its events;
+// the batch stops at the first failure, and unacknowledged entries are read
+// again once idle for minIdle, by this or another replica
+// Events carry their event ID as the JetStream message ID, so a retry after a
+// crash between publish and acknowledgement is deduplicated
+// An entry that still fails after maxDeliveries reads while JetStream answers is
+// poison: it is moved to the shard's dead-letter stream instead of blocking the
+// shard forever (0 retries forever)
+// Returns the number of entries relayed
+func (s *BiddingService) RelayOutbox(ctx context.Context, shard int, consumer string, batch int64, minIdle, block time.Duration, maxDeliveries int64) (int, error) {
+	entries, err := s.redis.ReadOutbox(ctx, shard, consumer, batch, minIdle, block)
+	if err != nil {
+		return 0, err
+	}
+
+	relayed := 0
+	for _, entry := range entries {
+		var publishErr error
+		for _, event := range outboxEvents(entry) {
+			if err := s.publishToArchivalQueue(entry.ItemID, event, jetstream.WithMsgID(eventID(event))); err != nil {
+				publishErr = err
+				break
+			}
+		}
+		if publishErr != nil && maxDeliveries > 0 && entry.Deliveries >= maxDeliveries && s.jetStreamAvailable(ctx) {
+			if err := s.redis.DeadLetterOutbox(ctx, shard, entry.ID, entry.Deliveries, publishErr.Error()); err != nil {
+				return relayed, err
+			}
+			outboxMetrics.Add("dead_lettered", 1)
+			fmt.Printf("[OUTBOX] Dead-lettered entry %s of item %s after %d deliveries: %v\n", entry.ID, entry.ItemID, entry.Deliveries, publishErr)
+			continue
+		}
+		if publishErr != nil {
+			// JetStream is likely down: stop here, the rest of the batch stays pending
+			// and is claimed again after minIdle
+			return relayed, fmt.Errorf("failed to relay entry %s of item %s: %w", entry.ID, entry.ItemID, publishErr)
+		}
+
+		if err := s.redis.AckOutbox(ctx, shard, entry.ID); err != nil {
+			return relayed, err
+		}
+		outboxMetrics.Add("relayed", 1)
+		relayed++
+	}
+	return relayed, nil
+}
+
+// jetStreamAvailable reports whether JetStream answers, telling an entry that
+// fails on its own from an outage that fails every entry
+func (s *BiddingService) jetStreamAvailable(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.js.AccountInfo(ctx)
+	return err == nil
+}
+
+// eventID returns the event ID of a relayed event, its JetStream message ID
+func eventID(event interface{}) string {
+	switch e := event.(type) {
+	case *models.BidEvent:
+		return e.EventID
+	case *models.AuctionClosedEvent:
+		return e.EventID
+	case *models.PriceResetEvent:
+		return e.EventID
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+	"github.com/nats-io/nats.go"
+)
+
+// snapshotRequestSubject is the NATS request/reply subject the broadcast service
+// uses to look up the state of an item when a watcher subscribes to it
+const snapshotRequestSubject = "items.snapshot.*"
+
+// ServeSnapshotRequests answers item snapshot lookups from the broadcast service
+// Unknown items get an empty reply; like clock requests, each request is answered
+// by one gateway replica
+func (s *BiddingService) ServeSnapshotRequests() (*nats.Subscription, error) {
+	sub, err := s.nats.QueueSubscribe(snapshotRequestSubject, "api-gateway", func(msg *nats.Msg) {
+		itemID := strings.TrimPrefix(msg.Subject, "items.snapshot.")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		item, err := s.GetItem(ctx, itemID)
+		if err != nil {
+			if err := msg.Respond(nil); err != nil {
+				fmt.Printf("Warning: failed to answer snapshot request for item %s: %v\n", itemID, err)
+			}
+			return
+		}
+
+		data, err := json.Marshal(snapshotEvent(item))
+		if err != nil {
+			fmt.Printf("Warning: failed to marshal snapshot of item %s: %v\n", itemID, err)
+			return
+		}
+		if err := msg.Respond(data); err != nil {
+			fmt.Printf("Warning: failed to answer snapshot request for item %s: %v\n", itemID, err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to snapshot requests: %w", err)
+	}
+	return sub, nil
+}
+
+// snapshotEvent returns the public state of an item for its watchers
+// Sealed bids never reach the item hash, so the snapshot of a sealed auction
+// reveals only its bid count
+func snapshotEvent(item *models.Item) *models.ItemSnapshotEvent {
+	return &models.ItemSnapshotEvent{
+		Type:            models.EventTypeSnapshot,
+		ItemID:          item.ID,
+		Status:          item.Status,
+		AuctionType:     item.AuctionType,
+		CurrentBid:      item.CurrentBid,
+		Currency:        item.Currency,
+		HighestBidderID: item.HighestBidderID,
+		MinNextBid:      item.MinNextBid,
+		ClockPrice:      item.ClockPrice,
+		BidCount:        item.BidCount,
+		EndTime:         item.EndTime,
+		Seq:             item.Seq,
+		Timestamp:       time.Now().UTC(),
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// BanUser bans a user from bidding, buying and managing items
+func (s *BiddingService) BanUser(ctx context.Context, userID string) error {
+	if err := s.redis.BanUser(ctx, userID); err != nil {
+		return err
+	}
+	fmt.Printf("[ADMIN] Banned user %s\n", userID)
+	return nil
+}
+
+// UnbanUser lifts the ban of a user
+func (s *BiddingService) UnbanUser(ctx context.Context, userID string) error {
+	if err := s.redis.UnbanUser(ctx, userID); err != nil {
+		return err
+	}
+	fmt.Printf("[ADMIN] Unbanned user %s\n", userID)
+	return nil
+}
+
+// IsBanned reports whether a user is banned
+func (s *BiddingService) IsBanned(ctx context.Context, userID string) (bool, error) {
+	return s.redis.IsBanned(ctx, userID)
+}
@@ -86,8 +86,23 @@ func (c *NATSConsumer) Start(ctx context.Context) error {
 	}
 }
 
-// handleMessage processes a single bid event message from JetStream
+// handleMessage processes a single event message from JetStream
 func (c *NATSConsumer) handleMessage(ctx context.Context, msg jetstream.Msg) {
+	// Peek at the event type to dispatch (events without a type are bid events)
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg.Data(), &envelope); err == nil {
+		switch envelope.Type {
+		case models.EventTypeAuctionClosed:
+			c.handleAuctionClosed(ctx, msg)
+			return
+		case models.EventTypePriceReset:
+			c.handlePriceReset(ctx, msg)
+			return
+		}
+	}
+
 	// Parse the event
 	var event models.BidEvent
 	if err := json.Unmarshal(msg.Data(), &event); err != nil {
@@ -112,12 +127,15 @@ func (c *NATSConsumer) handleMessage(ctx context.Context, msg jetstream.Msg) {
 
 	// Get message metadata for logging
 	meta, _ := msg.Metadata()
-	if updated {
-		fmt.Printf("[JETSTREAM] Persisted bid event %s (item: %s, user: %s, amount: $%.2f, seq: %d) - UPDATED current_bid\n",
+	if event.Sealed {
+		fmt.Printf("[JETSTREAM] Persisted sealed bid event %s (item: %s, user: %s, amount: %s, seq: %d)\n",
 			event.EventID, event.ItemID, event.UserID, event.Amount, meta.Sequence.Stream)
-	} else {
-		fmt.Printf("[JETSTREAM] Persisted bid event %s (item: %s, user: %s, amount: $%.2f, seq: %d) - SKIPPED (higher bid exists)\n",
+	} else if updated {
+		fmt.Printf("[JETSTREAM] Persisted bid event %s (item: %s, user: %s, amount: %s, seq: %d) - UPDATED current_bid\n",
 			event.EventID, event.ItemID, event.UserID, event.Amount, meta.Sequence.Stream)
+	} else {
+		fmt.Printf("[JETSTREAM] Persisted bid event %s (item: %s, user: %s, amount: %s, seq: %d) - SKIPPED (stale or duplicate, bid seq %d)\n",
+			event.EventID, event.ItemID, event.UserID, event.Amount, meta.Sequence.Stream, event.Seq)
 	}
 
 	// Acknowledge successful processing
@@ -126,6 +144,59 @@ func (c *NATSConsumer) handleMessage(ctx context.Context, msg jetstream.Msg) {
 	}
 }
 
+// handleAuctionClosed records the final result of an auction in PostgreSQL
+func (c *NATSConsumer) handleAuctionClosed(ctx context.Context, msg jetstream.Msg) {
+	var event models.AuctionClosedEvent
+	if err := json.Unmarshal(msg.Data(), &event); err != nil {
+		fmt.Printf("[JETSTREAM] Failed to unmarshal auction closed event: %v\n", err)
+		msg.NakWithDelay(5 * time.Second)
+		return
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := c.db.CloseItem(dbCtx, &event); err != nil {
+		fmt.Printf("[JETSTREAM] Failed to persist auction close %s: %v\n", event.EventID, err)
+		msg.NakWithDelay(5 * time.Second)
+		return
+	}
+
+	fmt.Printf("[JETSTREAM] Persisted auction close of item %s (winner: %q, final price: %s %s)\n",
+		event.ItemID, event.WinnerID, event.FinalPrice, event.Currency)
+
+	if err := msg.Ack(); err != nil {
+		fmt.Printf("[JETSTREAM] Failed to ack message: %v\n", err)
+	}
+}
+
+// handlePriceReset voids the archived bids of an item whose price an admin reset
+func (c *NATSConsumer) handlePriceReset(ctx context.Context, msg jetstream.Msg) {
+	var event models.PriceResetEvent
+	if err := json.Unmarshal(msg.Data(), &event); err != nil {
+		fmt.Printf("[JETSTREAM] Failed to unmarshal price reset event: %v\n", err)
+		msg.NakWithDelay(5 * time.Second)
+		return
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	voided, err := c.db.ResetItemPrice(dbCtx, &event)
+	if err != nil {
+		fmt.Printf("[JETSTREAM] Failed to persist price reset %s: %v\n", event.EventID, err)
+		msg.NakWithDelay(5 * time.Second)
+		return
+	}
+
+	fmt.Printf("[JETSTREAM] Persisted price reset of item %s by %q (%d bids voided)\n",
+		event.ItemID, event.ResetBy, voided)
+
+	if err := msg.Ack(); err != nil {
+		fmt.Printf("[JETSTREAM] Failed to ack message: %v\n", err)
+	}
+}
+
 // persistBidEvent writes the bid event to PostgreSQL
 // Returns (updated bool, error) - updated indicates if item's current_bid was changed
 func (c *NATSConsumer) persistBidEvent(ctx context.Context, event *models.BidEvent) (bool, error) {
@@ -134,8 +205,13 @@ func (c *NATSConsumer) persistBidEvent(ctx context.Context, event *models.BidEve
 		return false, fmt.Errorf("failed to insert bid: %w", err)
 	}
 
-	// Update item's current bid (conditional - only if this bid is higher)
-	updated, err := c.db.UpdateItemCurrentBid(ctx, event.ItemID, event.Amount, event.UserID)
+	// Sealed bids are only an audit trail until close, the close event records the result
+	if event.Sealed {
+		return false, nil
+	}
+
+	// Update item's current bid (conditional - only if this bid is newer than the last applied)
+	updated, err := c.db.UpdateItemCurrentBid(ctx, event.ItemID, event.Amount, event.UserID, event.Seq)
 	if err != nil {
 		return false, fmt.Errorf("failed to update item: %w", err)
 	}
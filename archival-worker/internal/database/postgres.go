@@ -45,8 +45,8 @@ func (c *PostgresClient) InitSchema(ctx context.Context) error {
 		id VARCHAR(255) PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
 		description TEXT,
-		start_price DECIMAL(10, 2) NOT NULL,
-		current_bid DECIMAL(10, 2) DEFAULT 0,
+		start_price BIGINT NOT NULL,
+		current_bid BIGINT DEFAULT 0,
 		highest_bidder_id VARCHAR(255),
 		status VARCHAR(50) DEFAULT 'active',
 		start_time TIMESTAMP NOT NULL,
@@ -59,13 +59,49 @@ func (c *PostgresClient) InitSchema(ctx context.Context) error {
 		id VARCHAR(255) PRIMARY KEY,
 		item_id VARCHAR(255) NOT NULL,
 		user_id VARCHAR(255) NOT NULL,
-		amount DECIMAL(10, 2) NOT NULL,
+		amount BIGINT NOT NULL,
 		status VARCHAR(50) DEFAULT 'accepted',
 		timestamp TIMESTAMP NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE
 	);
 
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS winner_id VARCHAR(255);
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS final_price BIGINT;
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS reserve_met BOOLEAN;
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS buy_now BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS auction_type VARCHAR(50) NOT NULL DEFAULT 'english';
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+	ALTER TABLE bids ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+
+	-- Event sequence numbers (0 for events from gateways that didn't assign them):
+	-- items.seq is the latest applied price change, items.reset_seq the latest price reset
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE items ADD COLUMN IF NOT EXISTS reset_seq BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE bids ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+
+	-- Amounts are integer minor units (cents); convert the DECIMAL(10, 2)
+	-- columns of databases created by earlier versions
+	DO $$
+	DECLARE
+		col RECORD;
+	BEGIN
+		FOR col IN
+			SELECT table_name, column_name
+			FROM information_schema.columns
+			WHERE table_schema = current_schema()
+			  AND data_type = 'numeric'
+			  AND (table_name, column_name) IN
+			      (('items', 'start_price'), ('items', 'current_bid'), ('items', 'final_price'), ('bids', 'amount'))
+		LOOP
+			EXECUTE format('ALTER TABLE %I ALTER COLUMN %I DROP DEFAULT', col.table_name, col.column_name);
+			EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE BIGINT USING ROUND(%I * 100)',
+				col.table_name, col.column_name, col.column_name);
+		END LOOP;
+	END $$;
+	ALTER TABLE items ALTER COLUMN current_bid SET DEFAULT 0;
+
 	CREATE INDEX IF NOT EXISTS idx_bids_item_id ON bids(item_id);
 	CREATE INDEX IF NOT EXISTS idx_bids_user_id ON bids(user_id);
 	CREATE INDEX IF NOT EXISTS idx_bids_timestamp ON bids(timestamp);
@@ -80,10 +116,13 @@ func (c *PostgresClient) InitSchema(ctx context.Context) error {
 }
 
 // InsertBid inserts a bid record into the database
+// A bid older than the item's last price reset arrived late and is stored voided
 func (c *PostgresClient) InsertBid(ctx context.Context, event *models.BidEvent) error {
 	query := `
-		INSERT INTO bids (id, item_id, user_id, amount, timestamp, status)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO bids (id, item_id, user_id, amount, currency, timestamp, status, seq)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'USD'), $6,
+		        CASE WHEN $8::BIGINT > 0 AND $8 < (SELECT reset_seq FROM items WHERE id = $2) THEN 'voided' ELSE $7 END,
+		        $8)
 		ON CONFLICT (id) DO NOTHING
 	`
 
@@ -94,8 +133,10 @@ func (c *PostgresClient) InsertBid(ctx context.Context, event *models.BidEvent)
 		event.ItemID,
 		event.UserID,
 		event.Amount,
+		event.Currency,
 		event.Timestamp,
 		models.BidStatusAccepted,
+		event.Seq,
 	)
 
 	if err != nil {
@@ -105,20 +146,25 @@ func (c *PostgresClient) InsertBid(ctx context.Context, event *models.BidEvent)
 	return nil
 }
 
-// UpdateItemCurrentBid updates the current bid for an item only if the new bid is higher
+// UpdateItemCurrentBid updates the current bid for an item only if the bid is newer
+// than the last one applied: by sequence number, or for bids without one (seq 0)
+// if the new bid is higher
 // Returns (updated bool, error) - updated is true if the bid was actually applied
-func (c *PostgresClient) UpdateItemCurrentBid(ctx context.Context, itemID string, amount float64, bidderID string) (bool, error) {
-	// Conditional update: only update if new amount is higher than current
-	// This prevents race conditions when multiple workers process bids concurrently
+func (c *PostgresClient) UpdateItemCurrentBid(ctx context.Context, itemID string, amount models.Money, bidderID string, seq int64) (bool, error) {
+	// Conditional update: stale and duplicate events are skipped
+	// This prevents race conditions when multiple workers process bids concurrently,
+	// and a bid from before a price reset can't bring the old price back
 	query := `
 		UPDATE items
 		SET current_bid = $1,
 		    highest_bidder_id = $2,
+		    seq = GREATEST(seq, $4::BIGINT),
 		    updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3 AND (current_bid IS NULL OR current_bid < $1)
+		WHERE id = $3 AND CASE WHEN $4 > 0 THEN seq < $4
+		                       ELSE current_bid IS NULL OR current_bid < $1 END
 	`
 
-	result, err := c.db.ExecContext(ctx, query, amount, bidderID, itemID)
+	result, err := c.db.ExecContext(ctx, query, amount, bidderID, itemID, seq)
 	if err != nil {
 		return false, fmt.Errorf("failed to update item: %w", err)
 	}
@@ -129,7 +175,7 @@ func (c *PostgresClient) UpdateItemCurrentBid(ctx context.Context, itemID string
 	}
 
 	if rows == 0 {
-		// Either item doesn't exist, or bid is not higher than current
+		// Either item doesn't exist, or bid is stale
 		// Try to create item if it doesn't exist
 		err := c.createItemIfNotExists(ctx, itemID)
 		if err != nil {
@@ -137,7 +183,7 @@ func (c *PostgresClient) UpdateItemCurrentBid(ctx context.Context, itemID string
 		}
 
 		// Try update again after creating item
-		result, err = c.db.ExecContext(ctx, query, amount, bidderID, itemID)
+		result, err = c.db.ExecContext(ctx, query, amount, bidderID, itemID, seq)
 		if err != nil {
 			return false, fmt.Errorf("failed to update item after create: %w", err)
 		}
@@ -149,6 +195,113 @@ func (c *PostgresClient) UpdateItemCurrentBid(ctx context.Context, itemID string
 	return true, nil
 }
 
+// CloseItem records the final result of an auction
+// Creates the item with its full details if no bid ever created the placeholder row
+// The close's sequence number follows the item's last bid, so a bid relayed late
+// is skipped by UpdateItemCurrentBid and can't move the closed price
+func (c *PostgresClient) CloseItem(ctx context.Context, event *models.AuctionClosedEvent) error {
+	query := `
+		INSERT INTO items (id, name, description, start_price, current_bid, highest_bidder_id,
+		                   status, start_time, end_time, winner_id, final_price, closed_at, reserve_met, buy_now,
+		                   auction_type, currency, seq)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, NULLIF($6, ''), $5, $10, $11, $12,
+		        COALESCE(NULLIF($13, ''), 'english'), COALESCE(NULLIF($14, ''), 'USD'), $15)
+		ON CONFLICT (id) DO UPDATE
+		SET name = COALESCE(NULLIF(EXCLUDED.name, ''), items.name),
+		    description = COALESCE(NULLIF(EXCLUDED.description, ''), items.description),
+		    start_price = EXCLUDED.start_price,
+		    start_time = EXCLUDED.start_time,
+		    end_time = EXCLUDED.end_time,
+		    current_bid = EXCLUDED.current_bid,
+		    highest_bidder_id = COALESCE(EXCLUDED.highest_bidder_id, items.highest_bidder_id),
+		    status = EXCLUDED.status,
+		    winner_id = EXCLUDED.winner_id,
+		    final_price = EXCLUDED.final_price,
+		    closed_at = EXCLUDED.closed_at,
+		    reserve_met = EXCLUDED.reserve_met,
+		    buy_now = EXCLUDED.buy_now,
+		    auction_type = EXCLUDED.auction_type,
+		    currency = EXCLUDED.currency,
+		    seq = GREATEST(items.seq, EXCLUDED.seq),
+		    updated_at = CURRENT_TIMESTAMP
+	`
+
+	name := event.Name
+	if name == "" {
+		name = fmt.Sprintf("Item %s", event.ItemID)
+	}
+
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		event.ItemID,
+		name,
+		event.Description,
+		event.StartPrice,
+		event.FinalPrice,
+		event.WinnerID,
+		models.ItemStatusClosed,
+		event.StartTime,
+		event.EndTime,
+		event.ClosedAt,
+		event.ReserveMet,
+		event.BuyNow,
+		event.AuctionType,
+		event.Currency,
+		event.Seq,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to close item: %w", err)
+	}
+
+	return nil
+}
+
+// ResetItemPrice clears the current bid of an item and marks the bids placed
+// before the reset as voided, keeping them as an audit trail
+// Bids are ordered against the reset by sequence number (by timestamp for bids
+// without one); the current bid is kept if a bid after the reset was already applied
+// Returns the number of bids voided
+func (c *PostgresClient) ResetItemPrice(ctx context.Context, event *models.PriceResetEvent) (int64, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE items
+		SET current_bid = CASE WHEN $2::BIGINT = 0 OR seq < $2 THEN 0 ELSE current_bid END,
+		    highest_bidder_id = CASE WHEN $2 = 0 OR seq < $2 THEN NULL ELSE highest_bidder_id END,
+		    seq = GREATEST(seq, $2),
+		    reset_seq = GREATEST(reset_seq, $2),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, event.ItemID, event.Seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset item: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE bids
+		SET status = 'voided'
+		WHERE item_id = $1 AND status <> 'voided'
+		  AND ((seq > 0 AND seq < $3::BIGINT) OR (seq = 0 AND timestamp <= $2))
+	`, event.ItemID, event.Timestamp, event.Seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to void bids: %w", err)
+	}
+	voided, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit price reset: %w", err)
+	}
+	return voided, nil
+}
+
 // createItemIfNotExists creates a placeholder item if it doesn't exist
 func (c *PostgresClient) createItemIfNotExists(ctx context.Context, itemID string) error {
 	query := `
@@ -164,7 +317,7 @@ func (c *PostgresClient) createItemIfNotExists(ctx context.Context, itemID strin
 		itemID,
 		fmt.Sprintf("Item %s", itemID),
 		"Auto-generated item",
-		0.0,
+		0,
 		now,
 		now.Add(24*time.Hour),
 	)
@@ -175,7 +328,7 @@ func (c *PostgresClient) createItemIfNotExists(ctx context.Context, itemID strin
 // GetBidHistory retrieves the bid history for an item
 func (c *PostgresClient) GetBidHistory(ctx context.Context, itemID string, limit int) ([]*models.Bid, error) {
 	query := `
-		SELECT id, item_id, user_id, amount, timestamp, status
+		SELECT id, item_id, user_id, amount, currency, timestamp, status
 		FROM bids
 		WHERE item_id = $1
 		ORDER BY timestamp DESC
@@ -196,6 +349,7 @@ func (c *PostgresClient) GetBidHistory(ctx context.Context, itemID string, limit
 			&bid.ItemID,
 			&bid.UserID,
 			&bid.Amount,
+			&bid.Currency,
 			&bid.Timestamp,
 			&bid.Status,
 		)
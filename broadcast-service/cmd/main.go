@@ -7,12 +7,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/nats-io/nats.go"
 
+	"github.com/aaronwang/bidding-app/broadcast-service/internal/clock"
+	"github.com/aaronwang/bidding-app/broadcast-service/internal/snapshot"
 	wsHandler "github.com/aaronwang/bidding-app/broadcast-service/internal/websocket"
+	"github.com/aaronwang/bidding-app/shared/auth"
 	"github.com/aaronwang/bidding-app/shared/config"
 	"github.com/aaronwang/bidding-app/shared/models"
 )
@@ -34,7 +38,21 @@ func main() {
 	fmt.Println("Connected to NATS")
 
 	// Initialize WebSocket manager
-	wsManager := wsHandler.NewManager()
+	wsManager := wsHandler.NewManager(cfg.FanoutShards)
+
+	// Push price ticks of Dutch auctions to their watchers
+	dutchTicker := clock.NewDutchTicker(natsConn, wsManager, cfg.DutchTickInterval)
+	wsManager.OnSubscribe(dutchTicker.Track)
+	tickerCtx, stopTicker := context.WithCancel(context.Background())
+	defer stopTicker()
+	go dutchTicker.Run(tickerCtx)
+
+	// Send new watchers the current state of an item before its live events
+	snapshots := snapshot.NewFetcher(natsConn, cfg.SnapshotTimeout)
+	wsManager.SetSnapshotSource(snapshots.Fetch)
+
+	// Keep recent events so reconnecting clients can resume where they left off
+	wsManager.SetReplayBuffer(cfg.ReplayBufferSize)
 
 	// Start WebSocket manager (handles connection lifecycle)
 	go wsManager.Run()
@@ -46,22 +64,55 @@ func main() {
 	_, err = natsConn.Subscribe("bid_events.*", func(msg *nats.Msg) {
 		forwardStart := time.Now()
 
-		// Parse the bid event
+		// Parse the event (bid or auction closed, both carry item_id)
 		var bidEvent models.BidEvent
 		if err := json.Unmarshal(msg.Data, &bidEvent); err != nil {
 			fmt.Printf("Error unmarshaling bid event: %v\n", err)
 			return
 		}
 
+		// Dutch clock announcements are for the ticker, not for watchers
+		switch bidEvent.Type {
+		case models.EventTypeDutchClock:
+			var clockEvent models.DutchClockEvent
+			if err := json.Unmarshal(msg.Data, &clockEvent); err == nil {
+				dutchTicker.SetClock(&clockEvent)
+			}
+			return
+		case models.EventTypeAuctionClosed:
+			dutchTicker.Remove(bidEvent.ItemID)
+			wsManager.ExpireHistory(bidEvent.ItemID, cfg.ReplayRetention)
+		}
+
+		// Sealed auctions only broadcast bid counts until close; never forward a sealed bid
+		if bidEvent.Sealed {
+			fmt.Printf("[NATS→WS] Dropped sealed bid event for item %s\n", bidEvent.ItemID)
+			return
+		}
+
 		// Extract itemID from subject (bid_events.{itemID})
 		// Subject format: "bid_events.item123"
 		itemID := bidEvent.ItemID
 
-		// Direct broadcast to all WebSocket clients watching this item
-		wsManager.BroadcastDirect(itemID, msg.Data)
+		// Gateway publishes of different requests (and replicas) run in their own
+		// goroutines, so events may arrive out of order: drop any event older than one already forwarded (the auction closed
+		// event carries the item's last sequence number too, so replay and live delivery
+		// never show it twice; events without one always pass)
+		if bidEvent.Seq > 0 && !wsManager.AdvanceSeq(itemID, bidEvent.Seq) {
+			fmt.Printf("[NATS→WS] Dropped stale %s event for item %s (seq %d)\n", eventType(bidEvent.Type), itemID, bidEvent.Seq)
+			return
+		}
+
+		// Direct broadcast to all WebSocket clients watching this item; bids and bid
+		// counts are price updates that slow clients may skip for newer ones
+		priceUpdate := bidEvent.Type == "" || bidEvent.Type == models.EventTypeBid || bidEvent.Type == models.EventTypeBidCount
+		if err := wsManager.BroadcastEvent(itemID, bidEvent.Seq, msg.Data, priceUpdate); err != nil {
+			fmt.Printf("[NATS→WS] Failed to forward %s event for item %s: %v\n", eventType(bidEvent.Type), itemID, err)
+			return
+		}
 
 		forwardElapsed := time.Since(forwardStart).Microseconds()
-		fmt.Printf("[NATS→WS] Forwarded bid for item %s in %dµs\n", itemID, forwardElapsed)
+		fmt.Printf("[NATS→WS] Forwarded %s event for item %s in %dµs\n", eventType(bidEvent.Type), itemID, forwardElapsed)
 	})
 	if err != nil {
 		fmt.Printf("Failed to subscribe to NATS: %v\n", err)
@@ -69,8 +120,42 @@ func main() {
 	}
 	fmt.Println("Subscribed to bid events via NATS")
 
+	// Personal events (e.g. outbid notices) go to the user's /ws/users/me connections
+	_, err = natsConn.Subscribe("user_events.*", func(msg *nats.Msg) {
+		userID := strings.TrimPrefix(msg.Subject, "user_events.")
+		sent, err := wsManager.SendToUser(userID, msg.Data)
+		if err != nil {
+			fmt.Printf("[NATS→WS] Failed to forward personal event to user %s: %v\n", userID, err)
+			return
+		}
+		if sent > 0 {
+			fmt.Printf("[NATS→WS] Forwarded personal event to %d connections of user %s\n", sent, userID)
+		}
+	})
+	if err != nil {
+		fmt.Printf("Failed to subscribe to NATS: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Initialize HTTP server for WebSocket connections
-	handler := wsHandler.NewHandler(wsManager)
+	// Accept the API gateway's JWTs on WebSocket upgrades (off when no key is configured)
+	var verifier *auth.Verifier
+	if cfg.JWTSecret != "" || cfg.JWKSFile != "" {
+		verifier, err = auth.NewVerifier(auth.Config{
+			HMACSecret: cfg.JWTSecret,
+			JWKSFile:   cfg.JWKSFile,
+			Issuer:     cfg.JWTIssuer,
+			Audience:   cfg.JWTAudience,
+			Leeway:     30 * time.Second,
+		})
+		if err != nil {
+			fmt.Printf("Failed to initialize authentication: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("JWT authentication enabled")
+	}
+
+	handler := wsHandler.NewHandler(wsManager, verifier)
 	router := handler.SetupRoutes()
 
 	server := &http.Server{
@@ -110,14 +195,43 @@ func main() {
 
 // Config holds application configuration
 type Config struct {
-	ServerAddr string
-	NatsURL    string
+	ServerAddr        string
+	NatsURL           string
+	DutchTickInterval time.Duration // How often Dutch auction watchers get the clock price
+	SnapshotTimeout   time.Duration // How long to wait for the gateway's item snapshot
+	ReplayBufferSize  int           // Events kept per item for reconnecting clients
+	ReplayRetention   time.Duration // How long the events of a closed auction are kept
+	FanoutShards      int           // Fan-out workers, each serving a share of the items
+
+	// JWT authentication, same keys as the API gateway
+	JWTSecret   string
+	JWKSFile    string
+	JWTIssuer   string
+	JWTAudience string
 }
 
 // loadConfig loads configuration from environment variables
 func loadConfig() *Config {
 	return &Config{
-		ServerAddr: config.GetEnv("SERVER_ADDR", ":8081"),
-		NatsURL:    config.GetEnv("NATS_URL", "nats://localhost:4222"),
+		ServerAddr:        config.GetEnv("SERVER_ADDR", ":8081"),
+		NatsURL:           config.GetEnv("NATS_URL", "nats://localhost:4222"),
+		DutchTickInterval: time.Duration(config.GetEnvInt("DUTCH_TICK_INTERVAL_MS", 1000)) * time.Millisecond,
+		SnapshotTimeout:   time.Duration(config.GetEnvInt("SNAPSHOT_TIMEOUT_MS", 2000)) * time.Millisecond,
+		ReplayBufferSize:  config.GetEnvInt("REPLAY_BUFFER_SIZE", 128),
+		ReplayRetention:   time.Duration(config.GetEnvInt("REPLAY_RETENTION_SECONDS", 600)) * time.Second,
+		FanoutShards:      config.GetEnvInt("FANOUT_SHARDS", 0),
+
+		JWTSecret:   config.GetEnv("JWT_HMAC_SECRET", ""),
+		JWKSFile:    config.GetEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:   config.GetEnv("JWT_ISSUER", ""),
+		JWTAudience: config.GetEnv("JWT_AUDIENCE", ""),
+	}
+}
+
+// eventType returns the event type for logging, defaulting to bid for untyped events
+func eventType(t string) string {
+	if t == "" {
+		return models.EventTypeBid
 	}
+	return t
 }
@@ -0,0 +1,152 @@
+package clock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	wsHandler "github.com/aaronwang/bidding-app/broadcast-service/internal/websocket"
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// lookupRetry is how long an item found not to be a Dutch auction is remembered
+// before its watchers trigger another clock lookup
+const lookupRetry = 30 * time.Second
+
+// DutchTicker pushes the current clock price of open Dutch auctions to their
+// watchers. Clocks are learned from dutch_clock announcements on bid_events.* and,
+// for items created before this instance started, looked up from the gateway
+// (NATS request/reply on items.clock.{itemID}) when the first watcher connects
+type DutchTicker struct {
+	nats     *nats.Conn
+	manager  *wsHandler.Manager
+	interval time.Duration
+
+	mu      sync.Mutex
+	clocks  map[string]*models.DutchClockEvent // itemID -> clock
+	lookups map[string]time.Time               // itemID -> last lookup of a non-Dutch item
+}
+
+// NewDutchTicker creates a ticker pushing price ticks every interval
+func NewDutchTicker(natsConn *nats.Conn, manager *wsHandler.Manager, interval time.Duration) *DutchTicker {
+	return &DutchTicker{
+		nats:     natsConn,
+		manager:  manager,
+		interval: interval,
+		clocks:   make(map[string]*models.DutchClockEvent),
+		lookups:  make(map[string]time.Time),
+	}
+}
+
+// Track makes sure the clock of an item is known once it has watchers
+// It never blocks: the lookup runs in its own goroutine
+func (t *DutchTicker) Track(itemID string) {
+	t.mu.Lock()
+	_, known := t.clocks[itemID]
+	lookedUp, recent := t.lookups[itemID]
+	if known || (recent && time.Since(lookedUp) < lookupRetry) {
+		t.mu.Unlock()
+		return
+	}
+	t.lookups[itemID] = time.Now()
+	t.mu.Unlock()
+
+	go t.lookup(itemID)
+}
+
+// lookup asks the gateway for the clock of an item
+func (t *DutchTicker) lookup(itemID string) {
+	msg, err := t.nats.Request(fmt.Sprintf("items.clock.%s", itemID), nil, 2*time.Second)
+	if err != nil {
+		fmt.Printf("[CLOCK] Failed to look up clock of item %s: %v\n", itemID, err)
+		return
+	}
+
+	var event models.DutchClockEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		fmt.Printf("[CLOCK] Failed to parse clock of item %s: %v\n", itemID, err)
+		return
+	}
+	t.SetClock(&event)
+}
+
+// SetClock stores (or, without a Dutch rule, forgets) the clock of an item
+func (t *DutchTicker) SetClock(event *models.DutchClockEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if event.Dutch == nil {
+		delete(t.clocks, event.ItemID)
+		return
+	}
+	t.clocks[event.ItemID] = event
+	delete(t.lookups, event.ItemID)
+	fmt.Printf("[CLOCK] Tracking Dutch auction %s\n", event.ItemID)
+}
+
+// Remove stops the price ticks of an item (e.g. when its auction closed)
+func (t *DutchTicker) Remove(itemID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.clocks, itemID)
+}
+
+// Run pushes price ticks until the context is cancelled
+// This should run in a goroutine
+func (t *DutchTicker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.tick(now)
+		}
+	}
+}
+
+// tick pushes the clock price of every open Dutch auction that has watchers
+func (t *DutchTicker) tick(now time.Time) {
+	t.mu.Lock()
+	var clocks []*models.DutchClockEvent
+	for itemID, clock := range t.clocks {
+		if !now.Before(clock.EndTime) {
+			delete(t.clocks, itemID)
+			continue
+		}
+		if now.Before(clock.StartTime) || t.manager.GetSubscriberCount(itemID) == 0 {
+			continue
+		}
+		clocks = append(clocks, clock)
+	}
+	t.mu.Unlock()
+
+	for _, clock := range clocks {
+		event := &models.PriceTickEvent{
+			Type:       models.EventTypePriceTick,
+			ItemID:     clock.ItemID,
+			ClockPrice: models.DutchClockPrice(clock.StartPrice, clock.StartTime, clock.Dutch, now),
+			FloorPrice: clock.Dutch.FloorPrice,
+			Currency:   clock.Currency,
+			Timestamp:  now.UTC(),
+		}
+		if next := models.DutchNextDrop(clock.StartPrice, clock.StartTime, clock.Dutch, now); !next.IsZero() {
+			event.NextDropAt = &next
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			fmt.Printf("[CLOCK] Failed to marshal price tick: %v\n", err)
+			continue
+		}
+		if err := t.manager.BroadcastLatest(clock.ItemID, payload); err != nil {
+			fmt.Printf("[CLOCK] Failed to broadcast price tick: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/aaronwang/bidding-app/shared/models"
+)
+
+// Fetcher looks up the state of items from the gateway (NATS request/reply on
+// items.snapshot.{itemID}) for watchers that just subscribed
+type Fetcher struct {
+	nats    *nats.Conn
+	timeout time.Duration
+}
+
+// NewFetcher creates a fetcher waiting up to timeout for each reply
+func NewFetcher(natsConn *nats.Conn, timeout time.Duration) *Fetcher {
+	return &Fetcher{
+		nats:    natsConn,
+		timeout: timeout,
+	}
+}
+
+// Fetch returns the snapshot event of an item and its sequence number
+// The payload is nil for items the gateway doesn't know
+func (f *Fetcher) Fetch(itemID string) ([]byte, int64, error) {
+	msg, err := f.nats.Request(fmt.Sprintf("items.snapshot.%s", itemID), nil, f.timeout)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to request snapshot: %w", err)
+	}
+	if len(msg.Data) == 0 {
+		return nil, 0, nil
+	}
+
+	var event models.ItemSnapshotEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	return msg.Data, event.Seq, nil
+}
@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"expvar"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Delivery modes, chosen per connection with the mode query parameter
+const (
+	// DeliveryAll queues every event; a client that falls a full Send buffer
+	// behind is disconnected
+	DeliveryAll = "all"
+	// DeliveryLatest keeps only the newest pending price update per item, for
+	// clients that only show the current price; nothing else is ever skipped
+	DeliveryLatest = "latest"
+)
+
+// maxOutbox is the most messages waiting for a DeliveryLatest client
+// Price updates take one slot per item, so only a peer that stopped reading
+// while the items' other events piled up gets there
+const maxOutbox = 1024
+
+// broadcastMetrics counts slow consumers, published at /debug/vars: "coalesced"
+// (price updates replaced by a newer one), "dropped" (messages never sent) and
+// "disconnected_slow" (clients dropped for falling behind)
+var broadcastMetrics = expvar.NewMap("broadcast")
+
+// itemEvent is an event of an item on its way to clients
+type itemEvent struct {
+	seq      int64
+	frame    *websocket.PreparedMessage // Shared by all the clients it is written to
+	coalesce bool                       // Only the newest matters (price updates), see DeliveryLatest
+}
+
+// textFrame prepares a text message once for all the connections it is written
+// to, which then share its encoded frame
+func textFrame(payload []byte) (*websocket.PreparedMessage, error) {
+	frame, err := websocket.NewPreparedMessage(websocket.TextMessage, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare message: %w", err)
+	}
+	return frame, nil
+}
+
+// deliver queues an event of an item for the client without blocking
+// Returns false if the client can't take it: its Send buffer is full or, in
+// DeliveryLatest mode, its outbox
+func (c *Client) deliver(itemID string, event itemEvent) bool {
+	if !c.Latest {
+		return c.trySend(event.frame)
+	}
+
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	// Replace the item's pending price update; it is forgotten once another
+	// event of the item is queued after it, which the update must not overtake
+	if i, ok := c.updates[itemID]; ok && event.coalesce {
+		c.outbox[i] = event.frame
+		broadcastMetrics.Add("coalesced", 1)
+		return true
+	}
+	if len(c.outbox) >= maxOutbox {
+		return false
+	}
+
+	c.push(event.frame)
+	if event.coalesce {
+		c.updates[itemID] = len(c.outbox) - 1
+	} else {
+		delete(c.updates, itemID)
+	}
+	return true
+}
+
+// sendControl queues a control message (welcome, reply) for the client without
+// blocking, in order with its item events: DeliveryLatest clients get it through
+// the outbox too, where no pending price update may overtake it
+// Returns false if the client can't take it
+func (c *Client) sendControl(frame *websocket.PreparedMessage) bool {
+	if !c.Latest {
+		return c.trySend(frame)
+	}
+
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if len(c.outbox) >= maxOutbox {
+		return false
+	}
+	c.push(frame)
+	clear(c.updates)
+	return true
+}
+
+// push appends a message to the outbox and wakes the write pump
+// The caller must hold c.outMu
+func (c *Client) push(frame *websocket.PreparedMessage) {
+	c.outbox = append(c.outbox, frame)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeOutbox returns the messages waiting for a DeliveryLatest client in order
+// and empties its outbox
+func (c *Client) takeOutbox() []*websocket.PreparedMessage {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	messages := c.outbox
+	c.outbox = nil
+	clear(c.updates)
+	return messages
+}
+
+// room returns how many more item events the client can take right now
+func (c *Client) room() int {
+	if !c.Latest {
+		return cap(c.Send) - len(c.Send)
+	}
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	return maxOutbox - len(c.outbox)
+}
+
+// trySend queues a message without blocking, returning false if Send is full
+func (c *Client) trySend(frame *websocket.PreparedMessage) bool {
+	select {
+	case c.Send <- frame:
+		return true
+	default:
+		return false
+	}
+}
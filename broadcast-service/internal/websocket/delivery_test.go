@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestDeliveryLatest checks what a client that stopped reading finds queued once
+// its write pump catches up: the welcome first, then, per item, only the newest
+// price update since the item's last other event, in order with replies and
+// the item's other events
+func TestDeliveryLatest(t *testing.T) {
+	const welcome = `{"type":"connected"}`
+	type step struct {
+		item     string // Event of the item, if set
+		seq      int64
+		coalesce bool   // Price update
+		ping     string // Otherwise a ping with this request ID
+	}
+	bid := func(item string, seq int64) step { return step{item: item, seq: seq, coalesce: true} }
+	closed := func(item string, seq int64) step { return step{item: item, seq: seq} }
+	ping := func(id string) step { return step{ping: id} }
+	text := func(s step) string {
+		switch {
+		case s.ping != "":
+			return fmt.Sprintf(`{"type":"pong","request_id":"%s"}`, s.ping)
+		case s.coalesce:
+			return fmt.Sprintf(`{"type":"bid","item_id":"%s","seq":%d}`, s.item, s.seq)
+		default:
+			return fmt.Sprintf(`{"type":"auction_closed","item_id":"%s","seq":%d}`, s.item, s.seq)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		latest bool
+		steps  []step
+		want   []step // Queued after the welcome
+	}{
+		{
+			name:   "newest update per item",
+			latest: true,
+			steps:  []step{bid("a", 1), bid("b", 1), bid("a", 2), bid("b", 2), bid("a", 3)},
+			want:   []step{bid("a", 3), bid("b", 2)},
+		},
+		{
+			name:   "updates don't overtake other events",
+			latest: true,
+			steps:  []step{bid("a", 1), bid("a", 2), closed("a", 3), bid("a", 4), bid("a", 5)},
+			want:   []step{bid("a", 2), closed("a", 3), bid("a", 5)},
+		},
+		{
+			name:   "other items' events don't stop replacing",
+			latest: true,
+			steps:  []step{bid("a", 1), closed("b", 7), bid("a", 2)},
+			want:   []step{bid("a", 2), closed("b", 7)},
+		},
+		{
+			name:   "updates don't overtake replies",
+			latest: true,
+			steps:  []step{bid("a", 1), ping("1"), bid("a", 2), bid("b", 1), bid("a", 3), ping("2")},
+			want:   []step{bid("a", 1), ping("1"), bid("a", 3), bid("b", 1), ping("2")},
+		},
+		{
+			name:  "all mode keeps every event",
+			steps: []step{bid("a", 1), bid("b", 1), ping("1"), bid("a", 2)},
+			want:  []step{bid("a", 1), bid("b", 1), ping("1"), bid("a", 2)},
+		},
+	}
+
+	pair := newConnPair(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, peer, err := pair.dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peer.Close()
+
+			m := NewManager(1)
+			client := NewClient(conn, "")
+			client.Latest = tt.latest
+			defer m.UnregisterClient(client)
+
+			// As the handler does: welcome, then subscriptions; without a write
+			// pump, the client reads nothing until the end
+			client.sendControl(mustFrame(t, welcome))
+			for _, itemID := range []string{"a", "b"} {
+				if err := m.Subscribe(client, itemID, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buffer []*Client
+			for _, s := range tt.steps {
+				if s.ping != "" {
+					m.handleClientMessage(client, []byte(fmt.Sprintf(`{"op":"ping","request_id":"%s"}`, s.ping)))
+					continue
+				}
+				job := &fanoutJob{itemID: s.item, event: itemEvent{seq: s.seq, frame: mustFrame(t, text(s)), coalesce: s.coalesce}}
+				buffer = m.shardFor(s.item).fanOut(m, job, buffer)
+			}
+
+			want := []string{welcome}
+			for _, s := range tt.want {
+				want = append(want, text(s))
+			}
+			if got := pair.texts(t, pending(client)); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v\nwant %v", got, want)
+			}
+		})
+	}
+}
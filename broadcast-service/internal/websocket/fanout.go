@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// shardQueueSize is the most events waiting for a shard's worker; broadcasting
+// blocks beyond it, slowing down the NATS subscription instead of buffering more
+const shardQueueSize = 4096
+
+// shard holds the subscriber sets of a share of the items, assigned by a hash of
+// the item ID, and fans out their events on one long-lived worker: an item's
+// events reach its clients in order, while different items fan out in parallel
+type shard struct {
+	id    int
+	mu    sync.RWMutex
+	items map[string]map[*Client]struct{} // itemID -> subscribers
+	jobs  chan *fanoutJob
+}
+
+// fanoutJob is an event on its way to the subscribers of an item
+type fanoutJob struct {
+	itemID string
+	event  itemEvent
+}
+
+// newShards creates count shards (one per CPU if count <= 0)
+func newShards(count int) []*shard {
+	if count <= 0 {
+		count = runtime.GOMAXPROCS(0)
+	}
+	shards := make([]*shard, count)
+	for i := range shards {
+		shards[i] = &shard{
+			id:    i,
+			items: make(map[string]map[*Client]struct{}),
+			jobs:  make(chan *fanoutJob, shardQueueSize),
+		}
+	}
+	return shards
+}
+
+// shardFor returns the shard of an item (FNV-1a of the item ID)
+func (m *Manager) shardFor(itemID string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(itemID); i++ {
+		hash ^= uint32(itemID[i])
+		hash *= 16777619
+	}
+	return m.shards[hash%uint32(len(m.shards))]
+}
+
+// addSubscriber indexes a client under an item
+func (m *Manager) addSubscriber(itemID string, client *Client) {
+	s := m.shardFor(itemID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscribers, ok := s.items[itemID]
+	if !ok {
+		subscribers = make(map[*Client]struct{})
+		s.items[itemID] = subscribers
+	}
+	subscribers[client] = struct{}{}
+}
+
+// removeSubscriber removes a client from an item's index
+func (m *Manager) removeSubscriber(itemID string, client *Client) {
+	s := m.shardFor(itemID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscribers, ok := s.items[itemID]
+	if !ok {
+		return
+	}
+	delete(subscribers, client)
+	if len(subscribers) == 0 {
+		delete(s.items, itemID)
+	}
+}
+
+// GetSubscriberCount returns the number of clients watching an item
+func (m *Manager) GetSubscriberCount(itemID string) int {
+	s := m.shardFor(itemID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items[itemID])
+}
+
+// broadcastToItem queues an event for the worker of the item's shard
+func (m *Manager) broadcastToItem(itemID string, event itemEvent) {
+	m.shardFor(itemID).jobs <- &fanoutJob{itemID: itemID, event: event}
+}
+
+// run fans out the shard's events until the manager stops
+// This should run in a goroutine
+func (s *shard) run(m *Manager) {
+	// Reused for every event, so fan-out doesn't allocate per event
+	var clients []*Client
+	for job := range s.jobs {
+		clients = s.fanOut(m, job, clients)
+	}
+}
+
+// fanOut delivers an event to the subscribers of its item and returns the
+// emptied client buffer
+// The subscribers are copied out first: delivering takes client locks, which
+// subscribing clients hold while indexing themselves in the shard
+func (s *shard) fanOut(m *Manager, job *fanoutJob, clients []*Client) []*Client {
+	startTime := time.Now()
+
+	s.mu.RLock()
+	for client := range s.items[job.itemID] {
+		clients = append(clients, client)
+	}
+	s.mu.RUnlock()
+
+	count := 0
+	for _, client := range clients {
+		if client.queue(job.itemID, job.event) {
+			count++
+		} else {
+			m.dropSlow(client)
+		}
+	}
+
+	elapsed := time.Since(startTime).Microseconds()
+	if count > 0 {
+		fmt.Printf("[TIMING] Broadcasted to %d clients (shard %d) in %dµs (%.2fµs/client)\n",
+			count, s.id, elapsed, float64(elapsed)/float64(count))
+	}
+
+	// Drop the references, so unregistered clients can be collected
+	clear(clients)
+	return clients[:0]
+}
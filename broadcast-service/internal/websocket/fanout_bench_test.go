@@ -0,0 +1,413 @@
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sink counts the bytes written to its discard connections and signals once
+// they reach the target
+type sink struct {
+	written atomic.Int64
+	target  atomic.Int64
+	reached chan struct{}
+}
+
+func newSink() *sink {
+	return &sink{reached: make(chan struct{}, 1)}
+}
+
+// expect sets the target to n more bytes than were written so far
+func (s *sink) expect(n int64) {
+	s.target.Store(s.written.Load() + n)
+}
+
+// wait blocks until the target is reached
+func (s *sink) wait(b *testing.B) {
+	select {
+	case <-s.reached:
+	case <-time.After(time.Minute):
+		b.Fatalf("wrote %d of %d bytes", s.written.Load(), s.target.Load())
+	}
+}
+
+// discardConn is a net.Conn that drops what is written to it and blocks reads
+// until closed, so WebSocket writes are framed and written for real without a
+// peer or socket in the way
+type discardConn struct {
+	sink   *sink
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *discardConn) Write(p []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	if written := c.sink.written.Add(int64(len(p))); written == c.sink.target.Load() {
+		c.sink.reached <- struct{}{}
+	}
+	return len(p), nil
+}
+
+func (c *discardConn) Read(p []byte) (int, error) {
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *discardConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *discardConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *discardConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *discardConn) SetDeadline(t time.Time) error      { return nil }
+func (c *discardConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *discardConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// hijacker is a ResponseWriter handing out a discard connection on Hijack
+type hijacker struct {
+	http.ResponseWriter
+	conn *discardConn
+}
+
+func (h *hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+// discardWebSocket returns a server-side WebSocket connection, upgraded by the
+// handler's upgrader, whose writes go to s
+func discardWebSocket(b *testing.B, s *sink) *websocket.Conn {
+	b.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	w := &hijacker{ResponseWriter: httptest.NewRecorder(), conn: &discardConn{sink: s, closed: make(chan struct{})}}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
+
+// frameSize returns the size of payload as an unmasked server text frame
+func frameSize(payload []byte) int64 {
+	switch n := int64(len(payload)); {
+	case n < 126:
+		return 2 + n
+	case n <= 65535:
+		return 4 + n
+	default:
+		return 10 + n
+	}
+}
+
+// legacyClient and legacyManager are the client and the fan-out of the manager
+// before sharding, copied as they were (only renamed, and without the handler
+// plumbing), so the sharded fan-out is measured against the code it replaced:
+// a sync.Map of subscribers per item, collected into a new slice per event, ten
+// goroutines spawned per event for 500 clients or more, and every client
+// framing the raw payload again in its write pump with WriteMessage
+type legacyClient struct {
+	ID     string
+	ItemID string
+	Conn   *websocket.Conn
+	Send   chan []byte
+}
+
+type legacyManager struct {
+	subscribers sync.Map // map[string]map[*legacyClient]bool
+	unregister  chan *legacyClient
+}
+
+// UnregisterClient requests client unregistration
+func (m *legacyManager) UnregisterClient(client *legacyClient) {
+	m.unregister <- client
+}
+
+// registerClient adds a client to the subscribers map
+func (m *legacyManager) registerClient(client *legacyClient) {
+	// Get or create the subscriber set for this item
+	subscribers, _ := m.subscribers.LoadOrStore(client.ItemID, &sync.Map{})
+	subscriberMap := subscribers.(*sync.Map)
+
+	// Add client to the set
+	subscriberMap.Store(client, true)
+
+	fmt.Printf("Client %s subscribed to item %s\n", client.ID, client.ItemID)
+
+	// Start goroutine to handle writes for this client
+	go client.writePump()
+}
+
+// broadcastToItem sends a message to all clients watching a specific item
+// Uses parallel broadcast with worker goroutines for better performance
+func (m *legacyManager) broadcastToItem(itemID string, payload []byte) {
+	startTime := time.Now()
+
+	if subscribers, ok := m.subscribers.Load(itemID); ok {
+		subscriberMap := subscribers.(*sync.Map)
+
+		// Collect all clients first
+		var clients []*legacyClient
+		subscriberMap.Range(func(key, value interface{}) bool {
+			client := key.(*legacyClient)
+			clients = append(clients, client)
+			return true
+		})
+
+		if len(clients) == 0 {
+			return
+		}
+
+		// For small-medium client counts, use sequential broadcast
+		// Sequential is faster than parallel for <500 clients due to lower overhead
+		if len(clients) < 500 {
+			count := 0
+			for _, client := range clients {
+				select {
+				case client.Send <- payload:
+					count++
+				default:
+					m.UnregisterClient(client)
+				}
+			}
+			elapsed := time.Since(startTime).Microseconds()
+			if count > 0 {
+				fmt.Printf("[TIMING] Broadcasted to %d clients (sequential) in %dµs (%.2fµs/client)\n",
+					count, elapsed, float64(elapsed)/float64(count))
+			}
+			return
+		}
+
+		// For larger counts, use parallel broadcast with workers
+		numWorkers := 10
+		batchSize := (len(clients) + numWorkers - 1) / numWorkers
+
+		var wg sync.WaitGroup
+		successCount := atomic.Int32{}
+
+		for i := 0; i < numWorkers; i++ {
+			start := i * batchSize
+			end := start + batchSize
+			if end > len(clients) {
+				end = len(clients)
+			}
+			if start >= len(clients) {
+				break
+			}
+
+			batch := clients[start:end]
+			wg.Add(1)
+
+			go func(batch []*legacyClient) {
+				defer wg.Done()
+				for _, client := range batch {
+					select {
+					case client.Send <- payload:
+						successCount.Add(1)
+					default:
+						m.UnregisterClient(client)
+					}
+				}
+			}(batch)
+		}
+
+		wg.Wait()
+
+		elapsed := time.Since(startTime).Microseconds()
+		count := successCount.Load()
+		if count > 0 {
+			fmt.Printf("[TIMING] Broadcasted to %d clients (parallel, %d workers) in %dµs (%.2fµs/client)\n",
+				count, numWorkers, elapsed, float64(elapsed)/float64(count))
+		}
+	}
+}
+
+// writePump pumps messages from the Send channel to the websocket connection
+func (c *legacyClient) writePump() {
+	ticker := time.NewTicker(54 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if !ok {
+				// Channel closed
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			// Send message
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			// Send ping to keep connection alive
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// silenceStdout discards the fan-out's logs for the rest of the benchmark
+func silenceStdout(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+// benchmarkFanout measures broadcasting one event to each of items items, whose
+// clients subscribers (spread evenly) are all connected, until every client's
+// write pump has written its frame to the connection: the sharded fan-out with
+// one prepared frame per event against the fan-out before sharding, which
+// framed the payload per client. Connections discard what is written, so only
+// the service's own work is measured, not the network
+func benchmarkFanout(b *testing.B, clients, items int) {
+	silenceStdout(b)
+	payload := []byte(`{"type":"bid","item_id":"item-1","amount":12345,"currency":"USD","seq":42}`)
+	perEvent := int64(clients) * frameSize(payload)
+	itemID := func(i int) string { return fmt.Sprintf("item-%d", i%items) }
+
+	b.Run("sharded", func(b *testing.B) {
+		s := newSink()
+		m := NewManager(8)
+		go m.Run()
+		subscribers := make([]*Client, clients)
+		for i := range subscribers {
+			subscribers[i] = NewClient(discardWebSocket(b, s), "", itemID(i))
+			m.RegisterClient(subscribers[i])
+		}
+		defer func() {
+			for _, client := range subscribers {
+				m.UnregisterClient(client)
+			}
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			s.expect(perEvent)
+			for i := 0; i < items; i++ {
+				if err := m.BroadcastEvent(itemID(i), int64(n+1), payload, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+			s.wait(b)
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(clients), "ns/client")
+	})
+
+	b.Run("per-client", func(b *testing.B) {
+		s := newSink()
+		m := &legacyManager{unregister: make(chan *legacyClient, clients)}
+		subscribers := make([]*legacyClient, clients)
+		for i := range subscribers {
+			subscribers[i] = &legacyClient{
+				ID:     fmt.Sprint(i),
+				ItemID: itemID(i),
+				Conn:   discardWebSocket(b, s),
+				Send:   make(chan []byte, 256),
+			}
+			m.registerClient(subscribers[i])
+		}
+		defer func() {
+			for _, client := range subscribers {
+				close(client.Send)
+			}
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			s.expect(perEvent)
+			for i := 0; i < items; i++ {
+				m.broadcastToItem(itemID(i), payload)
+			}
+			s.wait(b)
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(clients), "ns/client")
+	})
+}
+
+func BenchmarkFanout1KClients1Item(b *testing.B)     { benchmarkFanout(b, 1000, 1) }
+func BenchmarkFanout1KClients16Items(b *testing.B)   { benchmarkFanout(b, 1000, 16) }
+func BenchmarkFanout10KClients1Item(b *testing.B)    { benchmarkFanout(b, 10000, 1) }
+func BenchmarkFanout10KClients16Items(b *testing.B)  { benchmarkFanout(b, 10000, 16) }
+func BenchmarkFanout10KClients256Items(b *testing.B) { benchmarkFanout(b, 10000, 256) }
+
+// BenchmarkFrameWrite isolates the framing: one event written to clients
+// connections from one goroutine, as a prepared message encoded once against
+// WriteMessage framing it per connection
+func BenchmarkFrameWrite(b *testing.B) {
+	payload := []byte(`{"type":"bid","item_id":"item-1","amount":12345,"currency":"USD","seq":42}`)
+	const clients = 1000
+
+	s := newSink()
+	conns := make([]*websocket.Conn, clients)
+	for i := range conns {
+		conns[i] = discardWebSocket(b, s)
+	}
+	b.Cleanup(func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	b.Run("prepared", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			frame, err := textFrame(payload)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, conn := range conns {
+				if err := conn.WritePreparedMessage(frame); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/clients, "ns/client")
+	})
+
+	b.Run("per-client", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, conn := range conns {
+				if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/clients, "ns/client")
+	})
+}
@@ -1,10 +1,12 @@
 package websocket
 
 import (
+	"expvar"
 	"fmt"
 	"net/http"
+	"strconv"
 
-	"github.com/google/uuid"
+	"github.com/aaronwang/bidding-app/shared/auth"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -20,13 +22,16 @@ var upgrader = websocket.Upgrader{
 
 // Handler handles WebSocket connections
 type Handler struct {
-	manager *Manager
+	manager  *Manager
+	verifier *auth.Verifier // Validates bearer tokens (nil disables authentication)
 }
 
 // NewHandler creates a new WebSocket handler
-func NewHandler(manager *Manager) *Handler {
+// verifier authenticates connections that carry a token, nil disables authentication
+func NewHandler(manager *Manager, verifier *auth.Verifier) *Handler {
 	return &Handler{
-		manager: manager,
+		manager:  manager,
+		verifier: verifier,
 	}
 }
 
@@ -37,12 +42,21 @@ func (h *Handler) SetupRoutes() *mux.Router {
 	// WebSocket endpoint: /ws/items/{id}
 	router.HandleFunc("/ws/items/{id}", h.HandleWebSocket)
 
+	// Multiplexed WebSocket endpoint: /ws, items are (un)subscribed with messages
+	router.HandleFunc("/ws", h.HandleMultiplexedWebSocket)
+
+	// Personal events of the authenticated user: /ws/users/me
+	router.HandleFunc("/ws/users/me", h.HandleUserWebSocket)
+
 	// Health check
 	router.HandleFunc("/health", h.HealthCheck).Methods("GET")
 
 	// Stats endpoint
 	router.HandleFunc("/stats/items/{id}", h.GetStats).Methods("GET")
 
+	// Metrics (expvar JSON, e.g. coalesced and dropped messages)
+	router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+
 	return router
 }
 
@@ -56,6 +70,32 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A reconnecting client passes the last sequence number it saw to get the
+	// events it missed instead of a snapshot
+	var since int64
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	latest, err := deliveryMode(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Watching is public, but a token (Authorization header or access_token
+	// query parameter) must be valid; it is checked before the upgrade
+	userID, err := h.authenticate(r)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
 	// Upgrade connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -64,22 +104,126 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create client
-	client := &Client{
-		ID:     uuid.New().String(),
-		ItemID: itemID,
-		Conn:   conn,
-		Send:   make(chan []byte, 256), // Buffered channel for non-blocking sends
+	client := NewClient(conn, userID, itemID)
+	client.Latest = latest
+	if since > 0 {
+		client.ResumeFrom(itemID, since)
+	}
+
+	// Queue the welcome message first, so it precedes the item's snapshot
+	welcomeMsg := fmt.Sprintf(`{"type":"connected","itemId":"%s","clientId":"%s"}`, itemID, client.ID)
+	if !welcome(client, welcomeMsg) {
+		return
 	}
 
 	// Register client with manager
 	h.manager.RegisterClient(client)
 
 	// Start reading from client (handles disconnects)
-	client.StartReadPump(h.manager.unregister)
+	client.StartReadPump(h.manager)
+}
 
-	// Send welcome message
-	welcomeMsg := fmt.Sprintf(`{"type":"connected","itemId":"%s","clientId":"%s"}`, itemID, client.ID)
-	client.Send <- []byte(welcomeMsg)
+// HandleMultiplexedWebSocket upgrades a connection that can follow many items:
+// the client sends {"op": "subscribe" | "unsubscribe", "item_id": ...} and
+// {"op": "ping"} messages, each answered with an ack, pong or error reply that
+// echoes its request_id; item_id query parameters subscribe at connect
+func (h *Handler) HandleMultiplexedWebSocket(w http.ResponseWriter, r *http.Request) {
+	itemIDs := r.URL.Query()["item_id"]
+	if len(itemIDs) > MaxSubscriptions {
+		http.Error(w, ErrTooManySubscriptions.Error(), http.StatusBadRequest)
+		return
+	}
+	latest, err := deliveryMode(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Same authentication as /ws/items/{id}
+	userID, err := h.authenticate(r)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Failed to upgrade connection: %v\n", err)
+		return
+	}
+
+	client := NewClient(conn, userID, itemIDs...)
+	client.Latest = latest
+	welcomeMsg := fmt.Sprintf(`{"type":"connected","clientId":"%s"}`, client.ID)
+	if !welcome(client, welcomeMsg) {
+		return
+	}
+
+	h.manager.RegisterClient(client)
+	client.StartReadPump(h.manager)
+}
+
+// HandleUserWebSocket upgrades an authenticated connection that receives the
+// user's personal events (e.g. outbid notices)
+// Without authentication configured there is no way to tell who is connecting,
+// so the endpoint is unavailable
+func (h *Handler) HandleUserWebSocket(w http.ResponseWriter, r *http.Request) {
+	if h.verifier == nil {
+		http.Error(w, "Personal events require authentication", http.StatusNotFound)
+		return
+	}
+	userID, err := h.authenticate(r)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	if userID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Failed to upgrade connection: %v\n", err)
+		return
+	}
+
+	client := NewClient(conn, userID)
+	client.Personal = true
+	welcomeMsg := fmt.Sprintf(`{"type":"connected","userId":"%s","clientId":"%s"}`, userID, client.ID)
+	if !welcome(client, welcomeMsg) {
+		return
+	}
+
+	h.manager.RegisterClient(client)
+	client.StartReadPump(h.manager)
+}
+
+// deliveryMode reports whether a connection asked for DeliveryLatest with the
+// mode query parameter (DeliveryAll by default)
+func deliveryMode(r *http.Request) (bool, error) {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", DeliveryAll:
+		return false, nil
+	case DeliveryLatest:
+		return true, nil
+	default:
+		return false, fmt.Errorf("mode must be %q or %q", DeliveryAll, DeliveryLatest)
+	}
+}
+
+// authenticate returns the user ID of the token a connection carries, or an
+// empty user ID for connections without one
+func (h *Handler) authenticate(r *http.Request) (string, error) {
+	token := auth.TokenFromRequest(r)
+	if h.verifier == nil || token == "" {
+		return "", nil
+	}
+	claims, err := h.verifier.Verify(token)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
 }
 
 // HealthCheck returns service health
@@ -100,3 +244,16 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"itemId":"%s","subscribers":%d}`, itemID, count)
 }
+
+// welcome queues the welcome message of a new connection
+// Returns false, after closing the connection, if it couldn't be prepared
+func welcome(client *Client, message string) bool {
+	frame, err := textFrame([]byte(message))
+	if err != nil {
+		fmt.Printf("Failed to welcome client %s: %v\n", client.ID, err)
+		client.Conn.Close()
+		return false
+	}
+	client.sendControl(frame)
+	return true
+}
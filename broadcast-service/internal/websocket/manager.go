@@ -1,36 +1,95 @@
 package websocket
 
 import (
-	"encoding/json"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // Manager manages all WebSocket connections
+// Clients are registered, subscribed and unregistered directly by the goroutine
+// at hand (handlers, pumps, broadcasts) rather than through the manager loop, so
+// a broadcast can drop a slow client without waiting on itself. Every path that
+// ends a client goes through UnregisterClient, which runs its teardown once
 type Manager struct {
-	// Map of itemID -> set of connections watching that item
-	// Using sync.Map for concurrent access
-	subscribers sync.Map // map[string]map[*Client]bool
+	// Subscriber sets of the items and their fan-out workers, see shard
+	shards []*shard
 
-	// Channels for managing connections
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *BroadcastMessage
+	// Map of userID -> set of that user's /ws/users/me connections
+	users sync.Map // map[string]map[*Client]bool
 
-	// Mutex for thread-safe operations
-	mu sync.RWMutex
+	// Queued broadcasts, see Broadcast
+	broadcast chan *BroadcastMessage
+
+	// Called with the item ID whenever a client subscribes (must not block)
+	onSubscribe func(itemID string)
+
+	// Highest event sequence number forwarded per item
+	lastSeq sync.Map // map[string]*atomic.Int64
+
+	// Returns the snapshot sent to clients when they subscribe (nil: no snapshots)
+	snapshots SnapshotFunc
+
+	// Latest events per item for clients resuming after a reconnect
+	history     sync.Map // map[string]*eventHistory
+	historySize int      // Events kept per item, 0 disables replay
 }
 
 // Client represents a WebSocket client connection
 type Client struct {
 	ID     string
-	ItemID string
+	UserID string // Authenticated watcher, empty for anonymous connections
 	Conn   *websocket.Conn
-	Send   chan []byte
+	Send   chan *websocket.PreparedMessage // Never closed, so sends can't panic; done stops the write pump
+
+	// Personal connections (/ws/users/me) receive the user's personal events
+	// instead of items' events
+	Personal bool
+
+	// Latest selects DeliveryLatest: items' events and replies are queued on the
+	// outbox, where pending price updates are replaced by newer ones, instead of
+	// Send; one queue keeps them in order
+	Latest  bool
+	outMu   sync.Mutex
+	outbox  []*websocket.PreparedMessage
+	updates map[string]int // itemID -> outbox index of its replaceable price update
+	wake    chan struct{}  // Signals the write pump that the outbox has messages
+
+	mu     sync.Mutex
+	items  map[string]bool // Items the client is subscribed to
+	closed bool            // Set once unregistered, no further subscriptions
+	done   chan struct{}   // Closed together with closed being set
+
+	// Items whose snapshot is on its way or was just sent, see itemSync
+	syncs   map[string]*itemSync
+	syncing atomic.Int32 // len(syncs), checked without the lock
+
+	// Last sequence number seen per initial item, for clients resuming a stream
+	resume map[string]int64
+}
+
+// NewClient creates a client for a connection, subscribed to items
+func NewClient(conn *websocket.Conn, userID string, items ...string) *Client {
+	client := &Client{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Conn:   conn,
+		Send:   make(chan *websocket.PreparedMessage, 256), // Buffered channel for non-blocking sends
+		items:  make(map[string]bool, len(items)),
+		syncs:  make(map[string]*itemSync),
+		done:   make(chan struct{}),
+
+		updates: make(map[string]int),
+		wake:    make(chan struct{}, 1),
+	}
+	for _, itemID := range items {
+		client.items[itemID] = true
+	}
+	return client
 }
 
 // BroadcastMessage represents a message to broadcast to all clients watching an item
@@ -39,45 +98,40 @@ type BroadcastMessage struct {
 	Payload []byte
 }
 
-// NewManager creates a new WebSocket manager
-func NewManager() *Manager {
+// NewManager creates a new WebSocket manager fanning out over shards workers
+// (one per CPU if shards <= 0)
+func NewManager(shards int) *Manager {
 	return &Manager{
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		shards: newShards(shards),
 		// IMPORTANT: Large buffer to avoid blocking when broadcasting to thousands of clients.
 		// See EXPERIMENT_2_RESULTS.md: small buffer (256) caused freezes at 8K+ connections.
 		broadcast: make(chan *BroadcastMessage, 10000),
 	}
 }
 
-// Run starts the manager's main loop
+// Run starts the fan-out workers and the manager's main loop, which delivers
+// queued broadcasts
 // This should run in a goroutine
 func (m *Manager) Run() {
-	for {
-		select {
-		case client := <-m.register:
-			m.registerClient(client)
-
-		case client := <-m.unregister:
-			m.unregisterClient(client)
+	for _, s := range m.shards {
+		go s.run(m)
+	}
 
-		case message := <-m.broadcast:
-			receiveTime := time.Now()
-			m.broadcastToItem(message.ItemID, message.Payload)
-			totalElapsed := time.Since(receiveTime).Microseconds()
-			fmt.Printf("[TIMING] Total broadcast processing took %dµs\n", totalElapsed)
+	for message := range m.broadcast {
+		receiveTime := time.Now()
+		if err := m.BroadcastDirect(message.ItemID, message.Payload); err != nil {
+			fmt.Printf("Failed to broadcast to item %s: %v\n", message.ItemID, err)
+			continue
 		}
+		totalElapsed := time.Since(receiveTime).Microseconds()
+		fmt.Printf("[TIMING] Total broadcast processing took %dµs\n", totalElapsed)
 	}
 }
 
-// RegisterClient adds a client to the manager
-func (m *Manager) RegisterClient(client *Client) {
-	m.register <- client
-}
-
-// UnregisterClient removes a client from the manager
-func (m *Manager) UnregisterClient(client *Client) {
-	m.unregister <- client
+// OnSubscribe sets a hook called whenever a client subscribes to an item
+// Must be set before Run; the hook runs on the subscribing goroutine and must not block
+func (m *Manager) OnSubscribe(hook func(itemID string)) {
+	m.onSubscribe = hook
 }
 
 // Broadcast sends a message to all clients watching an item
@@ -88,158 +142,256 @@ func (m *Manager) Broadcast(itemID string, payload []byte) {
 	}
 }
 
-// BroadcastDirect broadcasts directly without intermediate channel for lower latency
-func (m *Manager) BroadcastDirect(itemID string, payload []byte) {
-	m.broadcastToItem(itemID, payload)
+// BroadcastDirect broadcasts without the manager loop, straight to the item's
+// fan-out worker, for lower latency
+func (m *Manager) BroadcastDirect(itemID string, payload []byte) error {
+	frame, err := textFrame(payload)
+	if err != nil {
+		return err
+	}
+	m.broadcastToItem(itemID, itemEvent{frame: frame})
+	return nil
 }
 
-// registerClient adds a client to the subscribers map
-func (m *Manager) registerClient(client *Client) {
-	// Get or create the subscriber set for this item
-	subscribers, _ := m.subscribers.LoadOrStore(client.ItemID, &sync.Map{})
-	subscriberMap := subscribers.(*sync.Map)
+// BroadcastLatest broadcasts a price update of which only the newest matters
+// (e.g. a Dutch price tick): DeliveryLatest clients may skip it for a newer one
+func (m *Manager) BroadcastLatest(itemID string, payload []byte) error {
+	frame, err := textFrame(payload)
+	if err != nil {
+		return err
+	}
+	m.broadcastToItem(itemID, itemEvent{frame: frame, coalesce: true})
+	return nil
+}
 
-	// Add client to the set
-	subscriberMap.Store(client, true)
+// BroadcastEvent broadcasts an event with a sequence number directly, so clients
+// waiting for the item's snapshot skip it if the snapshot already reflects it
+// The event is kept in the item's history for clients resuming later; coalesce
+// marks price updates, see BroadcastLatest
+func (m *Manager) BroadcastEvent(itemID string, seq int64, payload []byte, coalesce bool) error {
+	frame, err := textFrame(payload)
+	if err != nil {
+		return err
+	}
+	event := itemEvent{seq: seq, frame: frame, coalesce: coalesce}
+	m.record(itemID, event)
+	m.broadcastToItem(itemID, event)
+	return nil
+}
 
-	fmt.Printf("Client %s subscribed to item %s\n", client.ID, client.ItemID)
+// AdvanceSeq records seq as the latest event sequence number of an item
+// Returns false if an event with the same or a later sequence number was already
+// seen: the event is a duplicate or arrived out of order and must be dropped
+func (m *Manager) AdvanceSeq(itemID string, seq int64) bool {
+	value, _ := m.lastSeq.LoadOrStore(itemID, &atomic.Int64{})
+	last := value.(*atomic.Int64)
+	for {
+		current := last.Load()
+		if seq <= current {
+			return false
+		}
+		if last.CompareAndSwap(current, seq) {
+			return true
+		}
+	}
+}
 
-	// Start goroutine to handle writes for this client
-	go client.writePump()
+// SendToUser sends a personal event to all of a user's personal connections
+// Returns the number of connections it was queued on
+func (m *Manager) SendToUser(userID string, payload []byte) (int, error) {
+	connections, ok := m.users.Load(userID)
+	if !ok {
+		return 0, nil
+	}
+	frame, err := textFrame(payload)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	connections.(*sync.Map).Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		if client.trySend(frame) {
+			count++
+		} else {
+			m.dropSlow(client)
+		}
+		return true
+	})
+	return count, nil
 }
 
-// unregisterClient removes a client and closes its connection
-func (m *Manager) unregisterClient(client *Client) {
-	if subscribers, ok := m.subscribers.Load(client.ItemID); ok {
-		subscriberMap := subscribers.(*sync.Map)
-		subscriberMap.Delete(client)
+// Subscribe adds an item to a client's subscriptions (a no-op if already subscribed)
+// A client that already saw the item's events up to since (0 if none) resumes
+// after them, see attach
+func (m *Manager) Subscribe(client *Client, itemID string, since int64) error {
+	client.mu.Lock()
+	if client.closed {
+		client.mu.Unlock()
+		return ErrClientClosed
 	}
+	if client.items[itemID] {
+		client.mu.Unlock()
+		return nil
+	}
+	if len(client.items) >= MaxSubscriptions {
+		client.mu.Unlock()
+		return ErrTooManySubscriptions
+	}
+	client.items[itemID] = true
+	// Indexed under the client's lock, so UnregisterClient can't miss it
+	m.attach(client, itemID, since)
+	client.mu.Unlock()
+
+	fmt.Printf("Client %s subscribed to item %s\n", client.ID, itemID)
+	if m.onSubscribe != nil {
+		m.onSubscribe(itemID)
+	}
+	return nil
+}
 
-	close(client.Send)
-	client.Conn.Close()
+// Unsubscribe removes an item from a client's subscriptions
+// Returns false if the client wasn't subscribed to it
+func (m *Manager) Unsubscribe(client *Client, itemID string) bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.items[itemID] {
+		return false
+	}
+	delete(client.items, itemID)
+	client.endSync(itemID)
+	m.removeSubscriber(itemID, client)
 
-	fmt.Printf("Client %s unsubscribed from item %s\n", client.ID, client.ItemID)
+	fmt.Printf("Client %s unsubscribed from item %s\n", client.ID, itemID)
+	return true
 }
 
-// broadcastToItem sends a message to all clients watching a specific item
-// Uses parallel broadcast with worker goroutines for better performance
-func (m *Manager) broadcastToItem(itemID string, payload []byte) {
-	startTime := time.Now()
-
-	if subscribers, ok := m.subscribers.Load(itemID); ok {
-		subscriberMap := subscribers.(*sync.Map)
+// ResumeFrom makes a client that wasn't registered yet resume one of its items
+// after the last sequence number it saw instead of starting with a snapshot
+func (c *Client) ResumeFrom(itemID string, since int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resume == nil {
+		c.resume = make(map[string]int64)
+	}
+	c.resume[itemID] = since
+}
 
-		// Collect all clients first
-		var clients []*Client
-		subscriberMap.Range(func(key, value interface{}) bool {
-			client := key.(*Client)
-			clients = append(clients, client)
-			return true
-		})
+// Subscriptions returns the items a client is subscribed to
+func (c *Client) Subscriptions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	items := make([]string, 0, len(c.items))
+	for itemID := range c.items {
+		items = append(items, itemID)
+	}
+	return items
+}
 
-		if len(clients) == 0 {
-			return
+// RegisterClient indexes a client under its user (personal connections) or
+// the items it was created with, and starts its write pump
+func (m *Manager) RegisterClient(client *Client) {
+	if client.Personal {
+		connections, _ := m.users.LoadOrStore(client.UserID, &sync.Map{})
+		connections.(*sync.Map).Store(client, true)
+		fmt.Printf("Client %s connected to the events of user %s\n", client.ID, client.UserID)
+	} else {
+		client.mu.Lock()
+		items := make([]string, 0, len(client.items))
+		for itemID := range client.items {
+			m.attach(client, itemID, client.resume[itemID])
+			items = append(items, itemID)
 		}
+		client.resume = nil
+		client.mu.Unlock()
 
-		// For small-medium client counts, use sequential broadcast
-		// Sequential is faster than parallel for <500 clients due to lower overhead
-		if len(clients) < 500 {
-			count := 0
-			for _, client := range clients {
-				select {
-				case client.Send <- payload:
-					count++
-				default:
-					m.UnregisterClient(client)
-				}
-			}
-			elapsed := time.Since(startTime).Microseconds()
-			if count > 0 {
-				fmt.Printf("[TIMING] Broadcasted to %d clients (sequential) in %dµs (%.2fµs/client)\n",
-					count, elapsed, float64(elapsed)/float64(count))
+		for _, itemID := range items {
+			fmt.Printf("Client %s subscribed to item %s\n", client.ID, itemID)
+			if m.onSubscribe != nil {
+				m.onSubscribe(itemID)
 			}
-			return
 		}
+	}
 
-		// For larger counts, use parallel broadcast with workers
-		numWorkers := 10
-		batchSize := (len(clients) + numWorkers - 1) / numWorkers
-
-		var wg sync.WaitGroup
-		successCount := atomic.Int32{}
+	// Start goroutine to handle writes for this client
+	go client.writePump(m)
+}
 
-		for i := 0; i < numWorkers; i++ {
-			start := i * batchSize
-			end := start + batchSize
-			if end > len(clients) {
-				end = len(clients)
-			}
-			if start >= len(clients) {
-				break
-			}
+// UnregisterClient removes a client from every index, stops its write pump and
+// closes its connection. It is the only teardown path: the read pump, the write
+// pump and broadcasts to a slow client all end here, from any goroutine
+// A client is only unregistered once; later calls are no-ops
+func (m *Manager) UnregisterClient(client *Client) {
+	m.unregisterClient(client)
+}
 
-			batch := clients[start:end]
-			wg.Add(1)
-
-			go func(batch []*Client) {
-				defer wg.Done()
-				for _, client := range batch {
-					select {
-					case client.Send <- payload:
-						successCount.Add(1)
-					default:
-						m.UnregisterClient(client)
-					}
-				}
-			}(batch)
+// unregisterClient implements UnregisterClient, returning false if the client
+// was already unregistered
+func (m *Manager) unregisterClient(client *Client) bool {
+	client.mu.Lock()
+	if client.closed {
+		client.mu.Unlock()
+		return false
+	}
+	client.closed = true
+	close(client.done)
+	items := client.items
+	client.items = nil
+	client.mu.Unlock()
+
+	if client.Personal {
+		if connections, ok := m.users.Load(client.UserID); ok {
+			connections.(*sync.Map).Delete(client)
 		}
+	}
+	for itemID := range items {
+		m.removeSubscriber(itemID, client)
+	}
 
-		wg.Wait()
+	client.Conn.Close()
 
-		elapsed := time.Since(startTime).Microseconds()
-		count := successCount.Load()
-		if count > 0 {
-			fmt.Printf("[TIMING] Broadcasted to %d clients (parallel, %d workers) in %dµs (%.2fµs/client)\n",
-				count, numWorkers, elapsed, float64(elapsed)/float64(count))
-		}
-	}
+	fmt.Printf("Client %s disconnected (%d subscriptions)\n", client.ID, len(items))
+	return true
 }
 
-// GetSubscriberCount returns the number of clients watching an item
-func (m *Manager) GetSubscriberCount(itemID string) int {
-	if subscribers, ok := m.subscribers.Load(itemID); ok {
-		subscriberMap := subscribers.(*sync.Map)
-		count := 0
-		subscriberMap.Range(func(_, _ interface{}) bool {
-			count++
-			return true
-		})
-		return count
+// dropSlow disconnects a client that can't keep up with its events
+// A broadcast may still reach a client being unregistered, whose buffer then
+// fills up; that isn't counted as a slow client
+func (m *Manager) dropSlow(client *Client) {
+	broadcastMetrics.Add("dropped", 1)
+	if m.unregisterClient(client) {
+		broadcastMetrics.Add("disconnected_slow", 1)
 	}
-	return 0
 }
 
-// writePump pumps messages from the Send channel to the websocket connection
-func (c *Client) writePump() {
+// writePump pumps messages from the Send channel or the outbox to the websocket connection
+// until the client is unregistered; a failed write unregisters it
+func (c *Client) writePump(m *Manager) {
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
 		ticker.Stop()
-		c.Conn.Close()
+		m.UnregisterClient(c)
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case <-c.done:
+			return
+
+		case message := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				// Channel closed
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+
+			// Send message, serialized once for all its recipients
+			if err := c.Conn.WritePreparedMessage(message); err != nil {
 				return
 			}
 
-			// Send message
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				return
+		case <-c.wake:
+			// Items' events of DeliveryLatest clients, written in one go
+			for _, message := range c.takeOutbox() {
+				c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := c.Conn.WritePreparedMessage(message); err != nil {
+					return
+				}
 			}
 
 		case <-ticker.C:
@@ -253,10 +405,8 @@ func (c *Client) writePump() {
 }
 
 // readPump pumps messages from the websocket connection to handle client input
-func (c *Client) readPump(unregister chan *Client) {
-	defer func() {
-		unregister <- c
-	}()
+func (c *Client) readPump(m *Manager) {
+	defer m.UnregisterClient(c)
 
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
@@ -273,16 +423,12 @@ func (c *Client) readPump(unregister chan *Client) {
 			break
 		}
 
-		// Handle client messages (e.g., subscriptions, heartbeats)
-		// For now, we just log them
-		var msg map[string]interface{}
-		if err := json.Unmarshal(message, &msg); err == nil {
-			fmt.Printf("Client %s sent: %v\n", c.ID, msg)
-		}
+		// Handle client requests (subscriptions, heartbeats)
+		m.handleClientMessage(c, message)
 	}
 }
 
 // StartReadPump starts the read pump for this client
-func (c *Client) StartReadPump(unregister chan *Client) {
-	go c.readPump(unregister)
+func (c *Client) StartReadPump(m *Manager) {
+	go c.readPump(m)
 }
@@ -0,0 +1,224 @@
+package websocket
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connPair dials a test server and returns both ends of the connection: the
+// server end for the manager's client, the peer end for the test
+type connPair struct {
+	server *httptest.Server
+	conns  chan *websocket.Conn
+}
+
+func newConnPair(t *testing.T) *connPair {
+	t.Helper()
+	p := &connPair{conns: make(chan *websocket.Conn)}
+	upgrader := websocket.Upgrader{}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		p.conns <- conn
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *connPair) dial() (server, peer *websocket.Conn, err error) {
+	url := "ws" + strings.TrimPrefix(p.server.URL, "http")
+	peer, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return <-p.conns, peer, nil
+}
+
+// texts decodes prepared messages, in order, by writing them over a connection
+func (p *connPair) texts(t *testing.T, frames []*websocket.PreparedMessage) []string {
+	t.Helper()
+	server, peer, err := p.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	defer peer.Close()
+
+	texts := make([]string, len(frames))
+	for i, frame := range frames {
+		if err := server.WritePreparedMessage(frame); err != nil {
+			t.Fatal(err)
+		}
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts[i] = string(data)
+	}
+	return texts
+}
+
+// pending returns the messages waiting in a client's Send buffer, or in its
+// outbox for DeliveryLatest clients, without a write pump
+func pending(c *Client) []*websocket.PreparedMessage {
+	if c.Latest {
+		return c.takeOutbox()
+	}
+	var frames []*websocket.PreparedMessage
+	for {
+		select {
+		case frame := <-c.Send:
+			frames = append(frames, frame)
+		default:
+			return frames
+		}
+	}
+}
+
+// TestManagerChurn connects, subscribes and disconnects thousands of clients
+// while items are broadcast to, tearing clients down from every path at once:
+// the read pump (peer hangs up), the write pump (write fails), the fan-out
+// (dropSlow) and direct UnregisterClient calls. Run with -race
+func TestManagerChurn(t *testing.T) {
+	clients, parallel := 3000, 200
+	if testing.Short() {
+		clients, parallel = 300, 50
+	}
+	const items = 16
+
+	m := NewManager(4)
+	m.SetReplayBuffer(32)
+	m.SetSnapshotSource(func(itemID string) ([]byte, int64, error) {
+		return []byte(`{"type":"snapshot"}`), 0, nil
+	})
+	go m.Run()
+
+	itemID := func(i int) string { return fmt.Sprintf("item-%d", i%items) }
+
+	// Broadcasters: every item gets events until the churn is over
+	stop := make(chan struct{})
+	var broadcasters sync.WaitGroup
+	var seq [items]atomic.Int64
+	var broadcasts atomic.Int64
+	for b := 0; b < 8; b++ {
+		broadcasters.Add(1)
+		go func(b int) {
+			defer broadcasters.Done()
+			for i := b; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n := seq[i%items].Add(1)
+				payload := []byte(fmt.Sprintf(`{"type":"bid","seq":%d}`, n))
+				if m.AdvanceSeq(itemID(i), n) {
+					m.BroadcastEvent(itemID(i), n, payload, i%3 != 0)
+					broadcasts.Add(1)
+				}
+			}
+		}(b)
+	}
+
+	pair := newConnPair(t)
+	var churn sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	all := make([]*Client, clients)
+	for i := 0; i < clients; i++ {
+		slots <- struct{}{}
+		churn.Add(1)
+		go func(i int) {
+			defer churn.Done()
+			defer func() { <-slots }()
+
+			conn, peer, err := pair.dial()
+			if err != nil {
+				t.Errorf("dial: %v", err)
+				return
+			}
+			defer peer.Close()
+
+			client := NewClient(conn, "", itemID(i))
+			client.Latest = i%2 == 0
+			if i%5 == 0 {
+				client.ResumeFrom(itemID(i), seq[i%items].Load())
+			}
+			all[i] = client
+			m.RegisterClient(client)
+			client.StartReadPump(m)
+
+			// Peers that read keep their write pump busy; the others fall behind
+			if i%4 != 0 {
+				go func() {
+					for {
+						if _, _, err := peer.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+			}
+
+			for j := 1; j <= 3; j++ {
+				m.Subscribe(client, itemID(i+j), 0)
+			}
+			m.Unsubscribe(client, itemID(i+1))
+			time.Sleep(time.Duration(rand.Intn(2000)) * time.Microsecond)
+
+			// Tear down from several paths at the same time
+			var teardown sync.WaitGroup
+			paths := []func(){
+				func() { m.UnregisterClient(client) },
+				func() { m.dropSlow(client) },
+				func() { peer.Close() },                        // Read pump fails
+				func() { m.Subscribe(client, itemID(i+5), 0) }, // Races with the teardown
+			}
+			for _, path := range paths[i%2:] {
+				teardown.Add(1)
+				go func(path func()) {
+					defer teardown.Done()
+					path()
+				}(path)
+			}
+			teardown.Wait()
+			m.UnregisterClient(client)
+		}(i)
+	}
+	churn.Wait()
+	close(stop)
+	broadcasters.Wait()
+
+	for i, client := range all {
+		if client == nil {
+			continue
+		}
+		select {
+		case <-client.done:
+		default:
+			t.Fatalf("client %d not torn down", i)
+		}
+		if subscriptions := client.Subscriptions(); len(subscriptions) != 0 {
+			t.Fatalf("client %d still subscribed to %v", i, subscriptions)
+		}
+		if err := m.Subscribe(client, itemID(i), 0); err != ErrClientClosed {
+			t.Fatalf("Subscribe after teardown = %v, want ErrClientClosed", err)
+		}
+	}
+
+	for i := 0; i < items; i++ {
+		if count := m.GetSubscriberCount(itemID(i)); count != 0 {
+			t.Fatalf("item %s still has %d subscribers", itemID(i), count)
+		}
+	}
+	t.Logf("%d clients churned through %d broadcasts", clients, broadcasts.Load())
+}
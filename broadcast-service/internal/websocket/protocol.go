@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MaxSubscriptions is the most items one connection may follow
+const MaxSubscriptions = 200
+
+// Subscription errors, reported to the client in an error reply
+var (
+	ErrClientClosed         = errors.New("connection closed")
+	ErrTooManySubscriptions = fmt.Errorf("at most %d subscriptions per connection", MaxSubscriptions)
+)
+
+// Operations of the /ws protocol
+const (
+	OpSubscribe   = "subscribe"
+	OpUnsubscribe = "unsubscribe"
+	OpPing        = "ping"
+)
+
+// ClientMessage is a request sent by a client:
+// {"op": "subscribe", "item_id": "item_123", "request_id": "1"}
+type ClientMessage struct {
+	Op        string `json:"op"`
+	RequestID string `json:"request_id,omitempty"` // Echoed in the reply
+	ItemID    string `json:"item_id,omitempty"`    // For subscribe and unsubscribe
+	Since     int64  `json:"since,omitempty"`      // For subscribe: last sequence number seen, to resume after
+}
+
+// Reply types
+const (
+	ReplyAck   = "ack"
+	ReplyPong  = "pong"
+	ReplyError = "error"
+)
+
+// ServerReply answers a ClientMessage
+type ServerReply struct {
+	Type      string `json:"type"` // ReplyAck, ReplyPong or ReplyError
+	RequestID string `json:"request_id,omitempty"`
+	Op        string `json:"op,omitempty"`
+	ItemID    string `json:"item_id,omitempty"`
+	Error     string `json:"error,omitempty"` // Only present for ReplyError
+}
+
+// handleClientMessage runs a request from a client and replies to it
+func (m *Manager) handleClientMessage(c *Client, message []byte) {
+	var msg ClientMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		c.reply(&ServerReply{Type: ReplyError, Error: "invalid JSON"})
+		return
+	}
+
+	reply := &ServerReply{Type: ReplyAck, RequestID: msg.RequestID, Op: msg.Op, ItemID: msg.ItemID}
+	switch msg.Op {
+	case OpPing:
+		reply.Type = ReplyPong
+		reply.Op = ""
+	case OpSubscribe, OpUnsubscribe:
+		if msg.ItemID == "" {
+			reply.Type, reply.Error = ReplyError, "item_id is required"
+			break
+		}
+		if c.Personal {
+			reply.Type, reply.Error = ReplyError, "personal connections can't subscribe to items"
+			break
+		}
+		if msg.Op == OpUnsubscribe {
+			m.Unsubscribe(c, msg.ItemID)
+			break
+		}
+		if err := m.Subscribe(c, msg.ItemID, msg.Since); err != nil {
+			reply.Type, reply.Error = ReplyError, err.Error()
+		}
+	default:
+		reply.Type, reply.Error = ReplyError, fmt.Sprintf("unknown op %q", msg.Op)
+	}
+	c.reply(reply)
+}
+
+// reply queues a reply to the client, unless it is closed or its buffer is full
+// (the reply is then dropped; a client that stopped reading gets no answers)
+func (c *Client) reply(reply *ServerReply) {
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+
+	frame, err := textFrame(payload)
+	if err != nil {
+		fmt.Printf("Failed to reply to client %s: %v\n", c.ID, err)
+		return
+	}
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return
+	}
+	if !c.sendControl(frame) {
+		broadcastMetrics.Add("dropped", 1)
+	}
+}
@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestHandleClientMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		personal bool
+		setup    func(m *Manager, c *Client) // Runs before the message
+		message  string
+		want     ServerReply
+		wantSubs int // Subscriptions afterwards
+	}{
+		{
+			name:    "ping",
+			message: `{"op":"ping","request_id":"1"}`,
+			want:    ServerReply{Type: ReplyPong, RequestID: "1"},
+		},
+		{
+			name:     "subscribe",
+			message:  `{"op":"subscribe","item_id":"item-1","request_id":"2"}`,
+			want:     ServerReply{Type: ReplyAck, RequestID: "2", Op: OpSubscribe, ItemID: "item-1"},
+			wantSubs: 1,
+		},
+		{
+			name:     "subscribe twice",
+			setup:    func(m *Manager, c *Client) { m.Subscribe(c, "item-1", 0) },
+			message:  `{"op":"subscribe","item_id":"item-1"}`,
+			want:     ServerReply{Type: ReplyAck, Op: OpSubscribe, ItemID: "item-1"},
+			wantSubs: 1,
+		},
+		{
+			name:    "unsubscribe",
+			setup:   func(m *Manager, c *Client) { m.Subscribe(c, "item-1", 0) },
+			message: `{"op":"unsubscribe","item_id":"item-1","request_id":"3"}`,
+			want:    ServerReply{Type: ReplyAck, RequestID: "3", Op: OpUnsubscribe, ItemID: "item-1"},
+		},
+		{
+			name:    "unsubscribe without subscription",
+			message: `{"op":"unsubscribe","item_id":"item-1"}`,
+			want:    ServerReply{Type: ReplyAck, Op: OpUnsubscribe, ItemID: "item-1"},
+		},
+		{
+			name:    "subscribe without item",
+			message: `{"op":"subscribe","request_id":"4"}`,
+			want:    ServerReply{Type: ReplyError, RequestID: "4", Op: OpSubscribe, Error: "item_id is required"},
+		},
+		{
+			name:    "unsubscribe without item",
+			message: `{"op":"unsubscribe"}`,
+			want:    ServerReply{Type: ReplyError, Op: OpUnsubscribe, Error: "item_id is required"},
+		},
+		{
+			name:     "subscribe on a personal connection",
+			personal: true,
+			message:  `{"op":"subscribe","item_id":"item-1"}`,
+			want:     ServerReply{Type: ReplyError, Op: OpSubscribe, ItemID: "item-1", Error: "personal connections can't subscribe to items"},
+		},
+		{
+			name: "too many subscriptions",
+			setup: func(m *Manager, c *Client) {
+				for i := 0; i < MaxSubscriptions; i++ {
+					m.Subscribe(c, fmt.Sprintf("item-%d", i), 0)
+				}
+			},
+			message:  `{"op":"subscribe","item_id":"one-more"}`,
+			want:     ServerReply{Type: ReplyError, Op: OpSubscribe, ItemID: "one-more", Error: ErrTooManySubscriptions.Error()},
+			wantSubs: MaxSubscriptions,
+		},
+		{
+			name:    "unknown op",
+			message: `{"op":"publish","item_id":"item-1","request_id":"5"}`,
+			want:    ServerReply{Type: ReplyError, RequestID: "5", Op: "publish", ItemID: "item-1", Error: `unknown op "publish"`},
+		},
+		{
+			name:    "missing op",
+			message: `{"item_id":"item-1"}`,
+			want:    ServerReply{Type: ReplyError, ItemID: "item-1", Error: `unknown op ""`},
+		},
+		{
+			name:    "invalid JSON",
+			message: `{"op":"subscribe",`,
+			want:    ServerReply{Type: ReplyError, Error: "invalid JSON"},
+		},
+		{
+			name:    "not an object",
+			message: `["subscribe"]`,
+			want:    ServerReply{Type: ReplyError, Error: "invalid JSON"},
+		},
+		{
+			name:    "wrong field type",
+			message: `{"op":"subscribe","item_id":"item-1","since":"12"}`,
+			want:    ServerReply{Type: ReplyError, Error: "invalid JSON"},
+		},
+	}
+
+	pair := newConnPair(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, peer, err := pair.dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peer.Close()
+
+			m := NewManager(1)
+			client := NewClient(conn, "user-1")
+			client.Personal = tt.personal
+			defer m.UnregisterClient(client)
+			if tt.setup != nil {
+				tt.setup(m, client)
+			}
+			pending(client) // Setup replies aren't part of the test
+
+			m.handleClientMessage(client, []byte(tt.message))
+
+			texts := pair.texts(t, pending(client))
+			if len(texts) != 1 {
+				t.Fatalf("got %d replies, want 1: %v", len(texts), texts)
+			}
+			var got ServerReply
+			if err := json.Unmarshal([]byte(texts[0]), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("reply = %+v, want %+v", got, tt.want)
+			}
+			if subs := client.Subscriptions(); len(subs) != tt.wantSubs {
+				t.Errorf("%d subscriptions (%v), want %d", len(subs), subs, tt.wantSubs)
+			}
+		})
+	}
+}
+
+// TestReplyAfterClose checks that a closed connection gets no reply and a
+// subscription request is refused
+func TestReplyAfterClose(t *testing.T) {
+	pair := newConnPair(t)
+	conn, peer, err := pair.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	m := NewManager(1)
+	client := NewClient(conn, "")
+	m.UnregisterClient(client)
+
+	m.handleClientMessage(client, []byte(`{"op":"subscribe","item_id":"item-1"}`))
+	if frames := pending(client); len(frames) != 0 {
+		t.Errorf("closed client got %d replies", len(frames))
+	}
+	if err := m.Subscribe(client, "item-1", 0); err != ErrClientClosed {
+		t.Errorf("Subscribe = %v, want ErrClientClosed", err)
+	}
+}
@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// eventHistory is a ring buffer of an item's latest broadcast events, replayed
+// to clients resuming after a reconnect
+type eventHistory struct {
+	mu     sync.Mutex
+	events []itemEvent // Ring of up to cap(events) events, oldest at start once full
+	start  int
+}
+
+// newEventHistory creates a history keeping the latest size events
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{events: make([]itemEvent, 0, size)}
+}
+
+// add appends an event, evicting the oldest once full
+func (h *eventHistory) add(event itemEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.events) < cap(h.events) {
+		h.events = append(h.events, event)
+		return
+	}
+	h.events[h.start] = event
+	h.start = (h.start + 1) % len(h.events)
+}
+
+// since returns the events after the one with sequence number since, and the
+// sequence number of the newest event kept (at least since)
+// ok is false if events after since were already evicted (or never recorded),
+// or if since is ahead of every event kept: the client saw events the history
+// doesn't know, so what it missed can't be told
+func (h *eventHistory) since(since int64) (events []itemEvent, last int64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Events without a sequence number are replayed if they
+	// were broadcast after the event since
+	first := int64(0)
+	for i := range h.events {
+		event := h.events[(h.start+i)%len(h.events)]
+		if event.seq > 0 && first == 0 {
+			first = event.seq
+		}
+		if event.seq > last {
+			last = event.seq
+		}
+		if event.seq > 0 && event.seq <= since {
+			events = events[:0]
+			continue
+		}
+		events = append(events, event)
+	}
+	if first == 0 || first > since+1 || last < since {
+		return nil, 0, false
+	}
+	return events, last, true
+}
+
+// SetReplayBuffer makes the manager keep the latest size events of each item,
+// so clients can resume with the events after the last sequence number they saw
+// (0 disables replay). Must be set before Run
+func (m *Manager) SetReplayBuffer(size int) {
+	m.historySize = size
+}
+
+// record adds a broadcast event to its item's history
+func (m *Manager) record(itemID string, event itemEvent) {
+	if m.historySize <= 0 {
+		return
+	}
+	history, ok := m.history.Load(itemID)
+	if !ok {
+		history, _ = m.history.LoadOrStore(itemID, newEventHistory(m.historySize))
+	}
+	history.(*eventHistory).add(event)
+}
+
+// ExpireHistory forgets the history and the last sequence number of an item
+// after a delay, once no more events are expected for it (e.g. its auction
+// closed); until then late duplicates are still dropped
+func (m *Manager) ExpireHistory(itemID string, after time.Duration) {
+	time.AfterFunc(after, func() {
+		m.history.Delete(itemID)
+		m.lastSeq.Delete(itemID)
+	})
+}
+
+// replay sends a client the events of an item after since from its history
+// The caller must hold c.mu and have indexed the subscription already, so events
+// broadcast meanwhile are either in the history or wait for the lock and are
+// then checked against the replayed ones
+// Returns false if the history doesn't reach back to since or the replay
+// doesn't fit in the client's buffer; nothing was sent then
+func (m *Manager) replay(c *Client, itemID string, since int64, state *itemSync) bool {
+	history, ok := m.history.Load(itemID)
+	if !ok {
+		return false
+	}
+	events, last, ok := history.(*eventHistory).since(since)
+	if !ok || len(events) > c.room() {
+		return false
+	}
+
+	for _, event := range events {
+		c.deliver(itemID, event)
+	}
+	state.sent = true
+	state.seq = last
+	return true
+}
@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mustFrame prepares a text frame for a test
+func mustFrame(t testing.TB, text string) *websocket.PreparedMessage {
+	t.Helper()
+	frame, err := textFrame([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestEventHistorySince(t *testing.T) {
+	seqs := func(from, to int64) []int64 {
+		var s []int64
+		for seq := from; seq <= to; seq++ {
+			s = append(s, seq)
+		}
+		return s
+	}
+	tests := []struct {
+		name     string
+		size     int
+		recorded []int64 // Sequence numbers broadcast, 0 for events without one
+		since    int64
+		want     []int64
+		wantLast int64
+		wantOK   bool
+	}{
+		{name: "missed events", size: 8, recorded: seqs(1, 5), since: 2, want: seqs(3, 5), wantLast: 5, wantOK: true},
+		{name: "from the start", size: 8, recorded: seqs(1, 5), since: 0, want: seqs(1, 5), wantLast: 5, wantOK: true},
+		{name: "nothing missed", size: 8, recorded: seqs(1, 5), since: 5, want: nil, wantLast: 5, wantOK: true},
+		{name: "wrapped around", size: 4, recorded: seqs(1, 10), since: 7, want: seqs(8, 10), wantLast: 10, wantOK: true},
+		{name: "wrapped around, oldest kept", size: 4, recorded: seqs(1, 10), since: 6, want: seqs(7, 10), wantLast: 10, wantOK: true},
+		{name: "wrapped around, nothing missed", size: 4, recorded: seqs(1, 10), since: 10, want: nil, wantLast: 10, wantOK: true},
+		{name: "wrapped around twice", size: 3, recorded: seqs(1, 8), since: 6, want: seqs(7, 8), wantLast: 8, wantOK: true},
+		{name: "older than the buffer", size: 4, recorded: seqs(1, 10), since: 5},
+		{name: "far older than the buffer", size: 4, recorded: seqs(1, 10), since: 1},
+		{name: "history starts later", size: 8, recorded: seqs(5, 7), since: 2},
+		{name: "ahead of the newest event", size: 8, recorded: seqs(1, 5), since: 6},
+		{name: "far ahead of the newest event", size: 4, recorded: seqs(1, 10), since: 100},
+		{name: "empty", size: 4, since: 3},
+		{name: "only events without seq", size: 4, recorded: []int64{0, 0}, since: 3},
+		{name: "events without seq after since", size: 8, recorded: []int64{1, 2, 0, 3, 0}, since: 2, want: []int64{0, 3, 0}, wantLast: 3, wantOK: true},
+		{name: "events without seq before since", size: 8, recorded: []int64{1, 0, 2, 3}, since: 2, want: []int64{3}, wantLast: 3, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := newEventHistory(tt.size)
+			for _, seq := range tt.recorded {
+				history.add(itemEvent{seq: seq})
+			}
+
+			events, last, ok := history.since(tt.since)
+			var got []int64
+			for _, event := range events {
+				got = append(got, event.seq)
+			}
+			if ok != tt.wantOK || last != tt.wantLast || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("since(%d) = %v, %d, %v, want %v, %d, %v", tt.since, got, last, ok, tt.want, tt.wantLast, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestSubscribeResume checks what a client resuming from since receives: the
+// events it missed while the history still has them, the item's snapshot otherwise
+func TestSubscribeResume(t *testing.T) {
+	const size, current = 4, 10
+
+	tests := []struct {
+		name  string
+		since int64
+		want  []string
+	}{
+		{name: "missed events", since: 8, want: []string{`{"seq":9}`, `{"seq":10}`}},
+		{name: "nothing missed", since: current},
+		{name: "wrapped around", since: 6, want: []string{`{"seq":7}`, `{"seq":8}`, `{"seq":9}`, `{"seq":10}`}},
+		{name: "older than the buffer", since: 2, want: []string{`{"type":"snapshot","seq":10}`}},
+		{name: "ahead of the current seq", since: current + 5, want: []string{`{"type":"snapshot","seq":10}`}},
+		{name: "no since", since: 0, want: []string{`{"type":"snapshot","seq":10}`}},
+	}
+
+	pair := newConnPair(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(1)
+			m.SetReplayBuffer(size)
+			m.SetSnapshotSource(func(itemID string) ([]byte, int64, error) {
+				return []byte(fmt.Sprintf(`{"type":"snapshot","seq":%d}`, current)), current, nil
+			})
+			go m.Run()
+			for seq := int64(1); seq <= current; seq++ {
+				m.record("item-1", itemEvent{seq: seq, frame: mustFrame(t, fmt.Sprintf(`{"seq":%d}`, seq))})
+			}
+
+			conn, peer, err := pair.dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peer.Close()
+			client := NewClient(conn, "")
+			defer m.UnregisterClient(client)
+
+			if err := m.Subscribe(client, "item-1", tt.since); err != nil {
+				t.Fatal(err)
+			}
+			// The snapshot is sent from another goroutine, live events from the
+			// item's shard
+			collect := func(frames []*websocket.PreparedMessage, n int) []*websocket.PreparedMessage {
+				deadline := time.Now().Add(5 * time.Second)
+				for len(frames) < n && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+					frames = append(frames, pending(client)...)
+				}
+				return frames
+			}
+			frames := collect(pending(client), len(tt.want))
+
+			// A live event after the resume reaches the client exactly once
+			next := itemEvent{seq: current + 1, frame: mustFrame(t, fmt.Sprintf(`{"seq":%d}`, current+1))}
+			m.record("item-1", next)
+			m.broadcastToItem("item-1", next)
+			want := append(tt.want, fmt.Sprintf(`{"seq":%d}`, current+1))
+			frames = collect(frames, len(want))
+			time.Sleep(10 * time.Millisecond) // Nothing more arrives
+			frames = append(frames, pending(client)...)
+
+			if got := pair.texts(t, frames); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxHeldEvents is the most live events held back per item while its snapshot
+// is on its way; beyond it the oldest are dropped
+const maxHeldEvents = 256
+
+// SnapshotFunc returns the snapshot event of an item and its sequence number,
+// or a nil payload if there is none; it may block
+type SnapshotFunc func(itemID string) (payload []byte, seq int64, err error)
+
+// itemSync orders the snapshot (or replay) of one item before the item's live
+// events. Until it is sent, live events are held; afterwards events it already
+// reflects (Seq at or below its own) are dropped until a newer one passes, after
+// which the manager's per-item ordering suffices and the sync is removed
+type itemSync struct {
+	sent bool        // Snapshot or replay sent and held events flushed
+	seq  int64       // Sequence number of the snapshot or last replayed event
+	held []itemEvent // Live events received before the snapshot
+}
+
+// SetSnapshotSource makes the manager send each client a snapshot of an item
+// right after it subscribes (unless it resumes from its history), before any
+// live event of the item. Must be set before Run
+func (m *Manager) SetSnapshotSource(source SnapshotFunc) {
+	m.snapshots = source
+}
+
+// attach indexes a client under an item and brings it up to date first: with
+// since > 0 it replays the events after since if the item's history still has
+// them, otherwise it sends the item's snapshot
+// The caller must hold c.mu; live events are held meanwhile, so none gets
+// ahead of the replay or snapshot
+func (m *Manager) attach(c *Client, itemID string, since int64) {
+	if m.snapshots == nil && m.historySize <= 0 {
+		m.addSubscriber(itemID, c)
+		return
+	}
+
+	if _, ok := c.syncs[itemID]; !ok {
+		c.syncing.Add(1)
+	}
+	state := &itemSync{}
+	c.syncs[itemID] = state
+	m.addSubscriber(itemID, c)
+
+	switch {
+	case since > 0 && m.replay(c, itemID, since, state):
+		if state.seq == 0 {
+			c.endSync(itemID)
+		}
+	case m.snapshots != nil:
+		go m.sendSnapshot(c, itemID, state)
+	default:
+		c.endSync(itemID)
+	}
+}
+
+// sendSnapshot fetches the snapshot of an item, sends it to the client and then
+// flushes the live events held meanwhile
+func (m *Manager) sendSnapshot(c *Client, itemID string, state *itemSync) {
+	var frame *websocket.PreparedMessage
+	payload, seq, err := m.snapshots(itemID)
+	if err == nil && payload != nil {
+		frame, err = textFrame(payload)
+	}
+	if err != nil {
+		fmt.Printf("Failed to get snapshot of item %s for client %s: %v\n", itemID, c.ID, err)
+	}
+
+	c.mu.Lock()
+	// The client unsubscribed (or resubscribed, starting a new sync) meanwhile
+	if c.closed || c.syncs[itemID] != state {
+		c.mu.Unlock()
+		return
+	}
+
+	full := false
+	if frame != nil {
+		full = !c.deliver(itemID, itemEvent{seq: seq, frame: frame})
+	} else {
+		seq = 0
+	}
+	for _, event := range state.held {
+		if event.seq > 0 && event.seq <= seq {
+			continue
+		}
+		if !c.deliver(itemID, event) {
+			full = true
+		}
+	}
+	state.held = nil
+	state.sent = true
+	state.seq = seq
+	if seq == 0 || full {
+		c.endSync(itemID)
+	}
+	c.mu.Unlock()
+
+	if full {
+		m.dropSlow(c)
+	}
+}
+
+// endSync removes the sync of an item; the caller must hold c.mu
+func (c *Client) endSync(itemID string) {
+	if _, ok := c.syncs[itemID]; ok {
+		delete(c.syncs, itemID)
+		c.syncing.Add(-1)
+	}
+}
+
+// queue delivers a live event of an item to the client, or holds it while the
+// item's snapshot is on its way
+// Returns false if the client can't take the event, see deliver
+func (c *Client) queue(itemID string, event itemEvent) bool {
+	seq := event.seq
+	if c.syncing.Load() > 0 {
+		c.mu.Lock()
+		if state, ok := c.syncs[itemID]; ok {
+			switch {
+			case !state.sent:
+				if len(state.held) >= maxHeldEvents {
+					state.held = state.held[1:]
+					broadcastMetrics.Add("dropped", 1)
+				}
+				state.held = append(state.held, event)
+				c.mu.Unlock()
+				return true
+			case seq > 0 && seq <= state.seq:
+				// Already reflected in the snapshot
+				c.mu.Unlock()
+				return true
+			case seq > state.seq:
+				c.endSync(itemID)
+			}
+		}
+		c.mu.Unlock()
+	}
+	return c.deliver(itemID, event)
+}
@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// synced reports whether the snapshot of an item was sent to the client, along
+// with the events held meanwhile
+func synced(c *Client, itemID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.syncs[itemID]
+	return !ok || state.sent
+}
+
+// TestSnapshotOrdering checks that live events broadcast while an item's
+// snapshot is on its way are held until it is sent, that the ones it already
+// reflects are dropped, before and after it, and that the rest follow in order
+func TestSnapshotOrdering(t *testing.T) {
+	event := func(seq int64) string {
+		if seq == 0 {
+			return `{"type":"bid_count"}` // Events without a sequence number
+		}
+		return fmt.Sprintf(`{"seq":%d}`, seq)
+	}
+	snapshot := `{"type":"snapshot","seq":5}`
+
+	tests := []struct {
+		name        string
+		snapshotErr error
+		noSnapshot  bool    // The source has no snapshot of the item
+		during      []int64 // Broadcast while the snapshot is fetched
+		after       []int64 // Broadcast once it was sent
+		want        []string
+	}{
+		{
+			name:   "held events after the snapshot",
+			during: []int64{6, 7},
+			after:  []int64{8},
+			want:   []string{snapshot, event(6), event(7), event(8)},
+		},
+		{
+			name:   "held events the snapshot reflects",
+			during: []int64{3, 4, 5, 6, 7},
+			after:  []int64{8},
+			want:   []string{snapshot, event(6), event(7), event(8)},
+		},
+		{
+			name:   "held events without seq",
+			during: []int64{4, 0, 6, 0},
+			want:   []string{snapshot, event(0), event(6), event(0)},
+		},
+		{
+			name:   "late events the snapshot reflects",
+			during: []int64{4},
+			after:  []int64{5, 3, 6, 7},
+			want:   []string{snapshot, event(6), event(7)},
+		},
+		{
+			name:  "late events without held ones",
+			after: []int64{4, 5, 0, 6},
+			want:  []string{snapshot, event(0), event(6)},
+		},
+		{
+			name:        "failed snapshot",
+			snapshotErr: errors.New("redis down"),
+			during:      []int64{4, 6},
+			after:       []int64{5, 7},
+			want:        []string{event(4), event(6), event(5), event(7)},
+		},
+		{
+			name:       "no snapshot",
+			noSnapshot: true,
+			during:     []int64{4, 6},
+			after:      []int64{7},
+			want:       []string{event(4), event(6), event(7)},
+		},
+	}
+
+	pair := newConnPair(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetching := make(chan struct{})
+			release := make(chan struct{})
+			m := NewManager(1)
+			m.SetSnapshotSource(func(itemID string) ([]byte, int64, error) {
+				close(fetching)
+				<-release
+				if tt.snapshotErr != nil || tt.noSnapshot {
+					return nil, 0, tt.snapshotErr
+				}
+				return []byte(snapshot), 5, nil
+			})
+
+			conn, peer, err := pair.dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peer.Close()
+			client := NewClient(conn, "")
+			defer m.UnregisterClient(client)
+
+			broadcast := func(seqs []int64) {
+				for _, seq := range seqs {
+					if !client.queue("item-1", itemEvent{seq: seq, frame: mustFrame(t, event(seq))}) {
+						t.Fatalf("event %d not queued", seq)
+					}
+				}
+			}
+
+			if err := m.Subscribe(client, "item-1", 0); err != nil {
+				t.Fatal(err)
+			}
+			<-fetching
+			broadcast(tt.during)
+			if frames := pending(client); len(frames) != 0 {
+				t.Fatalf("%d events delivered before the snapshot", len(frames))
+			}
+			close(release)
+
+			// Wait for the snapshot and the held events
+			deadline := time.Now().Add(5 * time.Second)
+			for !synced(client, "item-1") && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			broadcast(tt.after)
+
+			got := pair.texts(t, pending(client))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, badly signed or expired
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims is the identity carried by a verified token
+type Claims struct {
+	Subject   string   `json:"sub"`             // User ID of the caller
+	Roles     []string `json:"roles,omitempty"` // Granted roles, see the Role constants
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"` // Unix seconds, required
+	NotBefore int64    `json:"nbf,omitempty"` // Unix seconds
+	IssuedAt  int64    `json:"iat,omitempty"` // Unix seconds
+}
+
+// Roles granted by the "roles" claim
+const (
+	RoleSeller = "seller" // May list items and manage their own
+	RoleBidder = "bidder" // May bid and buy
+	RoleAdmin  = "admin"  // May manage every item and user
+)
+
+// HasRole reports whether the claims grant role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Audience is the "aud" claim, a single string or a list of strings
+type Audience []string
+
+// UnmarshalJSON accepts both forms of the "aud" claim
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Config configures a Verifier; at least one of HMACSecret and JWKSFile is required
+type Config struct {
+	HMACSecret string        // Shared secret for HS256 tokens
+	JWKSFile   string        // Local JWKS file with the RSA public keys for RS256 tokens
+	Issuer     string        // Required "iss" (empty accepts any)
+	Audience   string        // Required "aud" entry (empty accepts any)
+	Leeway     time.Duration // Clock skew tolerated on exp and nbf
+}
+
+// Verifier validates signed JWTs (HS256 and RS256)
+type Verifier struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey // Key ID -> key
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// NewVerifier creates a verifier from the configured keys
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if cfg.HMACSecret == "" && cfg.JWKSFile == "" {
+		return nil, fmt.Errorf("no HMAC secret or JWKS file configured")
+	}
+
+	v := &Verifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		leeway:   cfg.Leeway,
+		now:      time.Now,
+	}
+	if cfg.HMACSecret != "" {
+		v.hmacSecret = []byte(cfg.HMACSecret)
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKeys = keys
+	}
+	return v, nil
+}
+
+// header is the JOSE header of a token
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Verify checks the signature and the time, issuer and audience claims of a
+// compact JWT and returns its claims
+// Only HS256 and RS256 are accepted, so "none" and algorithm confusion are rejected
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch hdr.Alg {
+	case "HS256":
+		if v.hmacSecret == nil {
+			return nil, fmt.Errorf("%w: HS256 tokens are not accepted", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "RS256":
+		key, err := v.rsaKey(hdr.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, hdr.Alg)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// rsaKey returns the RSA key for a key ID; tokens without one may use the only key
+func (v *Verifier) rsaKey(kid string) (*rsa.PublicKey, error) {
+	if len(v.rsaKeys) == 0 {
+		return nil, fmt.Errorf("%w: RS256 tokens are not accepted", ErrInvalidToken)
+	}
+	if kid == "" && len(v.rsaKeys) == 1 {
+		for _, key := range v.rsaKeys {
+			return key, nil
+		}
+	}
+	key, ok := v.rsaKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// validate checks the registered claims; tokens without exp are rejected, as
+// they would stay valid forever
+func (v *Verifier) validate(claims *Claims) error {
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	now := v.now()
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("%w: missing expiry", ErrInvalidToken)
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(v.leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(v.leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" && !claims.Audience.contains(v.audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func (a Audience) contains(audience string) bool {
+	for _, entry := range a {
+		if entry == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
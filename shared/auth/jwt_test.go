@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// testKeys is the RSA key pair of the test JWKS, with key ID "key-1"
+type testKeys struct {
+	private *rsa.PrivateKey
+	jwks    string // Path of the JWKS file
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &testKeys{private: key, jwks: path}
+}
+
+// sign builds a compact JWT; the signature is computed for HS256 and RS256,
+// with hmacKey or the RSA key, and left empty for any other algorithm
+func sign(t *testing.T, hdr map[string]string, claims map[string]interface{}, hmacKey []byte, rsaKey *rsa.PrivateKey) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(hdr) + "." + segment(claims)
+
+	var signature []byte
+	switch hdr["alg"] {
+	case "HS256":
+		mac := hmac.New(sha256.New, hmacKey)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&keys.private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	valid := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub":   "user_123",
+			"roles": []string{RoleBidder},
+			"iss":   "auth.example.com",
+			"aud":   "bidding-app",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	hs256 := map[string]string{"alg": "HS256", "typ": "JWT"}
+	rs256 := map[string]string{"alg": "RS256", "kid": "key-1"}
+
+	both := Config{HMACSecret: testSecret, JWKSFile: keys.jwks, Issuer: "auth.example.com", Audience: "bidding-app", Leeway: 30 * time.Second}
+	rsaOnly := Config{JWKSFile: keys.jwks, Issuer: "auth.example.com", Audience: "bidding-app"}
+	hmacOnly := Config{HMACSecret: testSecret}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		token   string
+		wantErr string // Empty for a valid token
+	}{
+		{
+			name:  "HS256",
+			cfg:   both,
+			token: sign(t, hs256, valid(nil), []byte(testSecret), nil),
+		},
+		{
+			name:  "RS256",
+			cfg:   both,
+			token: sign(t, rs256, valid(nil), nil, keys.private),
+		},
+		{
+			name:  "RS256 without kid uses the only key",
+			cfg:   rsaOnly,
+			token: sign(t, map[string]string{"alg": "RS256"}, valid(nil), nil, keys.private),
+		},
+		{
+			name:  "expired within leeway",
+			cfg:   both,
+			token: sign(t, hs256, valid(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}), []byte(testSecret), nil),
+		},
+		{
+			name:  "audience list",
+			cfg:   both,
+			token: sign(t, hs256, valid(map[string]interface{}{"aud": []string{"other", "bidding-app"}}), []byte(testSecret), nil),
+		},
+		{
+			name:    "alg none",
+			cfg:     both,
+			token:   sign(t, map[string]string{"alg": "none"}, valid(nil), nil, nil),
+			wantErr: `unsupported algorithm "none"`,
+		},
+		{
+			name:    "alg None",
+			cfg:     both,
+			token:   sign(t, map[string]string{"alg": "None"}, valid(nil), nil, nil),
+			wantErr: "unsupported algorithm",
+		},
+		{
+			name:    "HS256 signed with the RSA public key",
+			cfg:     rsaOnly,
+			token:   sign(t, hs256, valid(nil), publicDER, nil),
+			wantErr: "HS256 tokens are not accepted",
+		},
+		{
+			name:    "HS256 signed with the RSA public key next to a secret",
+			cfg:     both,
+			token:   sign(t, hs256, valid(nil), publicDER, nil),
+			wantErr: "signature mismatch",
+		},
+		{
+			name:    "RS256 without RSA keys",
+			cfg:     hmacOnly,
+			token:   sign(t, rs256, valid(nil), nil, keys.private),
+			wantErr: "RS256 tokens are not accepted",
+		},
+		{
+			name:    "unknown kid",
+			cfg:     both,
+			token:   sign(t, map[string]string{"alg": "RS256", "kid": "key-2"}, valid(nil), nil, keys.private),
+			wantErr: `unknown key "key-2"`,
+		},
+		{
+			name:    "RS256 signed with another key",
+			cfg:     both,
+			token:   sign(t, rs256, valid(nil), nil, other),
+			wantErr: "signature mismatch",
+		},
+		{
+			name:    "HS256 signed with another secret",
+			cfg:     both,
+			token:   sign(t, hs256, valid(nil), []byte("other-secret"), nil),
+			wantErr: "signature mismatch",
+		},
+		{
+			name: "claims changed after signing",
+			cfg:  both,
+			token: func() string {
+				token := sign(t, hs256, valid(nil), []byte(testSecret), nil)
+				parts := strings.Split(token, ".")
+				forged := sign(t, hs256, valid(map[string]interface{}{"roles": []string{RoleAdmin}}), []byte(testSecret), nil)
+				return parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+			}(),
+			wantErr: "signature mismatch",
+		},
+		{
+			name:    "expired",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), []byte(testSecret), nil),
+			wantErr: "token expired",
+		},
+		{
+			name:    "missing exp",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"exp": nil}), []byte(testSecret), nil),
+			wantErr: "missing expiry",
+		},
+		{
+			name:    "nbf in the future",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), []byte(testSecret), nil),
+			wantErr: "not valid yet",
+		},
+		{
+			name:    "wrong audience",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"aud": "other"}), []byte(testSecret), nil),
+			wantErr: "unexpected audience",
+		},
+		{
+			name:    "missing audience",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"aud": nil}), []byte(testSecret), nil),
+			wantErr: "unexpected audience",
+		},
+		{
+			name:    "wrong issuer",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"iss": "evil.example.com"}), []byte(testSecret), nil),
+			wantErr: "unexpected issuer",
+		},
+		{
+			name:    "missing subject",
+			cfg:     both,
+			token:   sign(t, hs256, valid(map[string]interface{}{"sub": nil}), []byte(testSecret), nil),
+			wantErr: "missing subject",
+		},
+		{
+			name:    "malformed",
+			cfg:     both,
+			token:   "not-a-token",
+			wantErr: "malformed token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.now = func() time.Time { return now }
+
+			claims, err := v.Verify(tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if claims.Subject != "user_123" || !claims.HasRole(RoleBidder) {
+					t.Errorf("claims = %+v, want user_123 with the bidder role", claims)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify = %v, want ErrInvalidToken", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -7,7 +7,8 @@ type Bid struct {
 	ID        string    `json:"id"`
 	ItemID    string    `json:"item_id"`
 	UserID    string    `json:"user_id"`
-	Amount    float64   `json:"amount"`
+	Amount    Money     `json:"amount"`
+	Currency  string    `json:"currency"`
 	Timestamp time.Time `json:"timestamp"`
 	Status    string    `json:"status"` // "accepted", "rejected"
 }
@@ -18,32 +19,92 @@ const (
 	BidStatusRejected = "rejected"
 )
 
+// Bid rejection reasons, reported in BidResponse.Reason
+const (
+	BidRejectTooLow           = "bid too low"
+	BidRejectItemNotFound     = "item not found"
+	BidRejectAuctionClosed    = "auction closed"
+	BidRejectNotStarted       = "auction not started"
+	BidRejectEnded            = "auction ended"
+	BidRejectProxyUnsupported = "proxy bidding not available for this auction type"
+	BidRejectCurrency         = "currency mismatch"
+)
+
 // BidRequest represents the incoming bid request from API
+// With MaxAmount set it is a proxy bid: the maximum stays secret and the system
+// bids on the user's behalf, one increment at a time, up to it (Amount is then
+// an optional opening bid)
 type BidRequest struct {
-	UserID string  `json:"user_id" binding:"required"`
-	Amount float64 `json:"amount" binding:"required,gt=0"`
+	UserID    string `json:"user_id" binding:"required"`
+	Amount    Money  `json:"amount" binding:"required,gt=0"`
+	MaxAmount Money  `json:"max_amount,omitempty"`
+	Currency  string `json:"currency,omitempty"` // Optional, must match the item's currency
+
+	IdempotencyKey string `json:"-"` // From the Idempotency-Key header, retries with it get the first result
 }
 
 // BidResponse represents the API response after placing a bid
 type BidResponse struct {
-	Success     bool    `json:"success"`
-	Message     string  `json:"message"`
-	CurrentBid  float64 `json:"current_bid"`
-	YourBid     float64 `json:"your_bid"`
-	IsHighest   bool    `json:"is_highest"`
-	EventID     string  `json:"event_id,omitempty"` // Only present for successful bids
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	CurrentBid Money  `json:"current_bid"`
+	YourBid    Money  `json:"your_bid"`
+	IsHighest  bool   `json:"is_highest"`
+	YourMax    Money  `json:"your_max,omitempty"` // Only present for proxy bids
+	MinNextBid Money  `json:"min_next_bid"`       // Lowest bid accepted after this one
+	Currency   string `json:"currency,omitempty"`
+	ReserveMet bool   `json:"reserve_met"`
+	Reason     string `json:"reason,omitempty"`   // Only present for rejected bids
+	EventID    string `json:"event_id,omitempty"` // Only present for successful bids
+	Seq        int64  `json:"seq,omitempty"`      // Item sequence number after this bid
 }
 
+// Event types, carried in the "type" field of every event published on
+// bid_events.{itemID} and bid.events.{itemID}
+// Events without a type are bid events from older gateways
+const (
+	EventTypeBid           = "bid"
+	EventTypeAuctionClosed = "auction_closed"
+	EventTypeBidCount      = "bid_count"
+	EventTypeDutchClock    = "dutch_clock"
+	EventTypePriceTick     = "price_tick"
+	EventTypePriceReset    = "price_reset"
+	EventTypeSnapshot      = "snapshot"
+)
+
 // BidEvent represents an event that gets published when a bid is accepted
 // This is sent to:
 // 1. Redis Pub/Sub (for real-time WebSocket broadcast)
 // 2. NATS/Kafka (for archival to PostgreSQL)
 type BidEvent struct {
-	EventID     string    `json:"event_id"`
-	ItemID      string    `json:"item_id"`
-	BidID       string    `json:"bid_id"`
-	UserID      string    `json:"user_id"`
-	Amount      float64   `json:"amount"`
-	PreviousBid float64   `json:"previous_bid"`
-	Timestamp   time.Time `json:"timestamp"`
+	Type            string    `json:"type"` // EventTypeBid
+	EventID         string    `json:"event_id"`
+	ItemID          string    `json:"item_id"`
+	BidID           string    `json:"bid_id"`
+	UserID          string    `json:"user_id"`
+	Amount          Money     `json:"amount"`
+	PreviousBid     Money     `json:"previous_bid"`
+	Currency        string    `json:"currency"`
+	Timestamp       time.Time `json:"timestamp"`
+	EndTime         time.Time `json:"end_time"`                    // Auction end time after this bid
+	EndTimeExtended bool      `json:"end_time_extended,omitempty"` // True if this bid triggered the soft-close extension
+	Proxy           bool      `json:"proxy,omitempty"`             // Placed automatically from the user's maximum bid
+	Sealed          bool      `json:"sealed,omitempty"`            // Bid in a sealed auction, only archived until close
+	OutbidUserID    string    `json:"outbid_user_id,omitempty"`    // Leader displaced by this bid (last event of a bid only)
+
+	// Seq numbers the price changes of an item, assigned by the bid script together
+	// with the change: consumers drop events with a Seq at or below the last one seen
+	// (0 for events from older gateways)
+	Seq int64 `json:"seq,omitempty"`
+}
+
+// BidCountEvent replaces BidEvent on the broadcast path of sealed auctions, which
+// must not reveal amounts or bidders before close
+type BidCountEvent struct {
+	Type      string    `json:"type"` // EventTypeBidCount
+	EventID   string    `json:"event_id"`
+	ItemID    string    `json:"item_id"`
+	BidCount  int64     `json:"bid_count"`
+	Seq       int64     `json:"seq,omitempty"` // Same as BidEvent.Seq
+	Timestamp time.Time `json:"timestamp"`
 }
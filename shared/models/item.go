@@ -4,21 +4,258 @@ import "time"
 
 // Item represents an auction item
 type Item struct {
-	ID          string    `json:"id"`
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Description     string         `json:"description"`
+	StartPrice      Money          `json:"start_price"`
+	CurrentBid      Money          `json:"current_bid"`
+	Currency        string         `json:"currency"` // ISO 4217 code of all amounts of the item
+	SellerID        string         `json:"seller_id,omitempty"`
+	HighestBidderID string         `json:"highest_bidder_id,omitempty"`
+	Status          string         `json:"status"`       // "scheduled", "active", "closed"
+	AuctionType     string         `json:"auction_type"` // "english", "sealed_first_price", "sealed_second_price", "dutch"
+	BidCount        int64          `json:"bid_count"`
+	Seq             int64          `json:"seq"` // Sequence number of the latest price change, see BidEvent.Seq
+	StartTime       time.Time      `json:"start_time"`
+	EndTime         time.Time      `json:"end_time"`
+	WinnerID        string         `json:"winner_id,omitempty"` // Only present once closed
+	SoftClose       *SoftCloseRule `json:"soft_close,omitempty"`
+	Dutch           *DutchRule     `json:"dutch,omitempty"`       // Only for Dutch auctions
+	ClockPrice      Money          `json:"clock_price,omitempty"` // Current Dutch clock price
+
+	// Bidding rules
+	MinIncrement   Money           `json:"min_increment,omitempty"`   // Fixed minimum raise
+	IncrementTiers []IncrementTier `json:"increment_tiers,omitempty"` // Price-dependent minimum raise
+	ReservePrice   Money           `json:"-"`                         // Hidden from bidders
+	HasReserve     bool            `json:"has_reserve"`
+	ReserveMet     bool            `json:"reserve_met"`
+	MinNextBid     Money           `json:"min_next_bid"` // Lowest bid currently accepted
+
+	// Buy-it-now: wins the item at BuyNowPrice and closes the auction
+	BuyNowPrice     Money `json:"buy_now_price,omitempty"`
+	BuyNowAvailable bool  `json:"buy_now_available"` // False once bidding passed the threshold
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Amounts converted to a display currency, only present when requested
+	Display *DisplayAmounts `json:"display,omitempty"`
+}
+
+// DisplayAmounts are the public amounts of an item converted to another currency
+// for display; bids are still placed in the item's Currency
+type DisplayAmounts struct {
+	Currency    string  `json:"currency"`
+	Rate        float64 `json:"rate"` // Units of Currency per unit of the item's currency
+	StartPrice  Money   `json:"start_price"`
+	CurrentBid  Money   `json:"current_bid"`
+	MinNextBid  Money   `json:"min_next_bid"`
+	BuyNowPrice Money   `json:"buy_now_price,omitempty"`
+	ClockPrice  Money   `json:"clock_price,omitempty"`
+}
+
+// ItemStatus constants
+const (
+	ItemStatusScheduled = "scheduled" // Created, StartTime not reached yet
+	ItemStatusActive    = "active"
+	ItemStatusClosed    = "closed"
+)
+
+// AuctionType constants
+// In sealed auctions bids stay hidden until close: the highest bid wins and pays
+// its own amount (first price) or the second-highest bid (second price / Vickrey)
+const (
+	AuctionTypeEnglish           = "english" // Open ascending auction (default)
+	AuctionTypeSealedFirstPrice  = "sealed_first_price"
+	AuctionTypeSealedSecondPrice = "sealed_second_price"
+	AuctionTypeDutch             = "dutch" // Descending clock price, the first bid at or above it wins
+)
+
+// IsSealed reports whether bids of the auction type stay hidden until close
+func IsSealed(auctionType string) bool {
+	return auctionType == AuctionTypeSealedFirstPrice || auctionType == AuctionTypeSealedSecondPrice
+}
+
+// SoftCloseRule configures anti-sniping for an item: any accepted bid in the
+// last WindowSeconds before EndTime extends EndTime by ExtensionSeconds,
+// but never more than MaxExtensionSeconds past the scheduled end time
+type SoftCloseRule struct {
+	WindowSeconds       int `json:"window_seconds"`
+	ExtensionSeconds    int `json:"extension_seconds"`
+	MaxExtensionSeconds int `json:"max_extension_seconds"` // 0 means no cap
+}
+
+// DutchRule configures a descending-price auction: the clock starts at the item's
+// StartPrice at StartTime and drops by DecrementAmount every DecrementIntervalSeconds
+// until it reaches FloorPrice
+type DutchRule struct {
+	FloorPrice               Money `json:"floor_price"`
+	DecrementAmount          Money `json:"decrement_amount"`
+	DecrementIntervalSeconds int   `json:"decrement_interval_seconds"`
+}
+
+// DutchClockPrice returns the clock price of a Dutch auction at now
+// Computed in whole minor units so the gateway, the bid script and the broadcast
+// service all agree on the price at any instant
+func DutchClockPrice(startPrice Money, startTime time.Time, rule *DutchRule, now time.Time) Money {
+	price := startPrice
+	interval := int64(rule.DecrementIntervalSeconds) * 1000
+	elapsed := now.UnixMilli() - startTime.UnixMilli()
+	if interval > 0 && elapsed > 0 {
+		price -= Money(elapsed/interval) * rule.DecrementAmount
+	}
+	if price < rule.FloorPrice {
+		price = rule.FloorPrice
+	}
+	return price
+}
+
+// DutchNextDrop returns when the clock price drops next, or the zero time once
+// it has reached the floor
+func DutchNextDrop(startPrice Money, startTime time.Time, rule *DutchRule, now time.Time) time.Time {
+	interval := int64(rule.DecrementIntervalSeconds) * 1000
+	if interval <= 0 || DutchClockPrice(startPrice, startTime, rule, now) <= rule.FloorPrice {
+		return time.Time{}
+	}
+	elapsed := now.UnixMilli() - startTime.UnixMilli()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return time.UnixMilli(startTime.UnixMilli() + (elapsed/interval+1)*interval).UTC()
+}
+
+// IncrementTier sets the minimum raise once the current bid reaches From
+// Tiers are sorted by From; the last tier at or below the current bid applies
+type IncrementTier struct {
+	From      Money `json:"from"`
+	Increment Money `json:"increment"`
+}
+
+// DefaultMinIncrement applies when an item has no increment rule
+const DefaultMinIncrement Money = 1
+
+// CreateItemRequest represents the incoming request to create an auction item
+type CreateItemRequest struct {
+	ID          string         `json:"id,omitempty"`        // Optional, generated when empty
+	SellerID    string         `json:"seller_id,omitempty"` // Ignored for authenticated callers, who sell as themselves
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	StartPrice  Money          `json:"start_price"`
+	Currency    string         `json:"currency,omitempty"` // Optional, defaults to DefaultCurrency
+	StartTime   time.Time      `json:"start_time"`         // Optional, defaults to now
+	EndTime     time.Time      `json:"end_time"`
+	AuctionType string         `json:"auction_type,omitempty"` // Optional, defaults to english
+	SoftClose   *SoftCloseRule `json:"soft_close,omitempty"`   // Optional anti-sniping rule
+	Dutch       *DutchRule     `json:"dutch,omitempty"`        // Required for Dutch auctions
+
+	// Optional bidding rules (MinIncrement and IncrementTiers are exclusive)
+	MinIncrement   Money           `json:"min_increment,omitempty"`
+	IncrementTiers []IncrementTier `json:"increment_tiers,omitempty"`
+	ReservePrice   Money           `json:"reserve_price,omitempty"`
+	BuyNowPrice    Money           `json:"buy_now_price,omitempty"` // Optional buy-it-now price
+}
+
+// UpdateItemRequest represents a partial update of an auction item
+// Only non-nil fields are applied
+type UpdateItemRequest struct {
+	Name        *string        `json:"name,omitempty"`
+	Description *string        `json:"description,omitempty"`
+	StartPrice  *Money         `json:"start_price,omitempty"`
+	StartTime   *time.Time     `json:"start_time,omitempty"`
+	EndTime     *time.Time     `json:"end_time,omitempty"`
+	AuctionType *string        `json:"auction_type,omitempty"`
+	SoftClose   *SoftCloseRule `json:"soft_close,omitempty"`
+	Dutch       *DutchRule     `json:"dutch,omitempty"`
+
+	MinIncrement   *Money          `json:"min_increment,omitempty"`
+	IncrementTiers []IncrementTier `json:"increment_tiers,omitempty"` // nil leaves tiers unchanged
+	ReservePrice   *Money          `json:"reserve_price,omitempty"`
+	BuyNowPrice    *Money          `json:"buy_now_price,omitempty"`
+}
+
+// BuyNowRequest represents the incoming request to buy an item at its buy-now price
+type BuyNowRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// AuctionClosedEvent is published once when an auction is closed, either by the
+// closing scheduler at EndTime, by a buy-now or manually through the API
+// It goes to the same subjects as BidEvent so watchers and the archive see it in order
+type AuctionClosedEvent struct {
+	Type        string    `json:"type"` // EventTypeAuctionClosed
+	EventID     string    `json:"event_id"`
+	ItemID      string    `json:"item_id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	StartPrice  float64   `json:"start_price"`
-	CurrentBid  float64   `json:"current_bid"`
-	HighestBidderID string `json:"highest_bidder_id,omitempty"`
-	Status      string    `json:"status"` // "active", "closed"
+	StartPrice  Money     `json:"start_price"`
 	StartTime   time.Time `json:"start_time"`
 	EndTime     time.Time `json:"end_time"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	AuctionType string    `json:"auction_type,omitempty"`
+	WinnerID    string    `json:"winner_id,omitempty"` // Empty if nobody bid or the reserve wasn't met
+	FinalPrice  Money     `json:"final_price"`
+	Currency    string    `json:"currency"`
+	ReserveMet  bool      `json:"reserve_met"`
+	BuyNow      bool      `json:"buy_now,omitempty"` // Closed by a buy-now at FinalPrice
+	ClosedAt    time.Time `json:"closed_at"`
+	Seq         int64     `json:"seq,omitempty"` // Item sequence number of the close, see BidEvent.Seq
 }
 
-// ItemStatus constants
-const (
-	ItemStatusActive = "active"
-	ItemStatusClosed = "closed"
-)
+// DutchClockEvent announces the clock of a Dutch auction so the broadcast service
+// can push price ticks to watchers; a nil Dutch rule means the item is not (or no
+// longer) a Dutch auction
+// It is published when a Dutch item is created or updated and sent in reply to
+// clock requests on items.clock.{itemID}
+type DutchClockEvent struct {
+	Type       string     `json:"type"` // EventTypeDutchClock
+	ItemID     string     `json:"item_id"`
+	StartPrice Money      `json:"start_price"`
+	Currency   string     `json:"currency"`
+	StartTime  time.Time  `json:"start_time"`
+	EndTime    time.Time  `json:"end_time"`
+	Dutch      *DutchRule `json:"dutch,omitempty"`
+}
+
+// PriceTickEvent is pushed periodically to watchers of an open Dutch auction
+type PriceTickEvent struct {
+	Type       string     `json:"type"` // EventTypePriceTick
+	ItemID     string     `json:"item_id"`
+	ClockPrice Money      `json:"clock_price"`
+	FloorPrice Money      `json:"floor_price"`
+	Currency   string     `json:"currency"`
+	NextDropAt *time.Time `json:"next_drop_at,omitempty"` // Absent once the floor is reached
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// PriceResetEvent is published when an admin discards all bids on an open item,
+// which then starts over at its start price
+type PriceResetEvent struct {
+	Type       string    `json:"type"` // EventTypePriceReset
+	EventID    string    `json:"event_id"`
+	ItemID     string    `json:"item_id"`
+	StartPrice Money     `json:"start_price"`
+	MinNextBid Money     `json:"min_next_bid"`
+	Currency   string    `json:"currency"`
+	ResetBy    string    `json:"reset_by,omitempty"` // Admin who reset the price
+	Seq        int64     `json:"seq"`                // Sequence number of the reset, bid events before it are stale
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ItemSnapshotEvent is the state of an item sent to a watcher right after it
+// subscribes, before any live event; live events with a Seq at or below the
+// snapshot's are already reflected in it
+// The gateway sends it in reply to snapshot requests on items.snapshot.{itemID}
+type ItemSnapshotEvent struct {
+	Type            string    `json:"type"` // EventTypeSnapshot
+	ItemID          string    `json:"item_id"`
+	Status          string    `json:"status"`
+	AuctionType     string    `json:"auction_type"`
+	CurrentBid      Money     `json:"current_bid"`
+	Currency        string    `json:"currency"`
+	HighestBidderID string    `json:"highest_bidder_id,omitempty"`
+	MinNextBid      Money     `json:"min_next_bid"`
+	ClockPrice      Money     `json:"clock_price,omitempty"` // Only for Dutch auctions
+	BidCount        int64     `json:"bid_count"`
+	EndTime         time.Time `json:"end_time"`
+	Seq             int64     `json:"seq"`
+	Timestamp       time.Time `json:"timestamp"`
+}
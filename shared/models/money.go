@@ -0,0 +1,157 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor units (cents) of the currency it belongs to
+// Amounts never carry their own currency: every amount of an item, its bids and
+// its events is in the item's Currency
+//
+// In JSON a Money is a decimal number of major units (12.5 -> 1250 cents), so
+// clients written against the old float amounts keep working; strings ("12.50")
+// are accepted too
+type Money int64
+
+// DefaultCurrency applies to items created without a currency (and to all items
+// created before amounts had one)
+const DefaultCurrency = "USD"
+
+// ValidCurrency reports whether code looks like an ISO 4217 currency code ("EUR")
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxMoney bounds the amounts ParseMoney and UnmarshalJSON accept, in either
+// direction: Redis Lua scripts hold amounts in doubles, which stay exact for
+// integers up to 2^53, so this leaves room for sums and multiples of amounts
+const MaxMoney Money = (1 << 53) / 100
+
+// NewMoney converts a major unit amount to Money, rounding to the nearest cent
+func NewMoney(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// ParseMoney parses a decimal amount of major units ("12.50", "12.5", "12")
+// Only digits, one '.' and a leading '-' are accepted, up to MaxMoney
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("invalid amount %q: more than 2 decimal places", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > int64(MaxMoney/100) {
+		return 0, fmt.Errorf("invalid amount %q: out of range", s)
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64) // Two digits
+	m := Money(units*100 + cents)
+	if m > MaxMoney {
+		return 0, fmt.Errorf("invalid amount %q: out of range", s)
+	}
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// isDigits reports whether s consists of ASCII digits only (true for "")
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Float64 returns the amount in major units, for display and logging only
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount as a decimal number of major units ("12.50")
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalBinary stores the amount as an integer of minor units ("1250"), the
+// form Redis keys and scripts use
+func (m Money) MarshalBinary() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(m), 10), nil
+}
+
+// MarshalJSON writes the amount as a decimal number of major units
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a decimal number (or string) of major units
+// Numbers with more than 2 decimal places or an exponent are rounded to the
+// nearest cent, as float clients may send 0.1+0.2 style values; amounts beyond
+// MaxMoney are rejected either way
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(s)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	if parsed, err := ParseMoney(string(data)); err == nil {
+		*m = parsed
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid amount %s: %w", data, err)
+	}
+	if math.Abs(f*100) > float64(MaxMoney) {
+		return fmt.Errorf("invalid amount %s: out of range", data)
+	}
+	*m = NewMoney(f)
+	return nil
+}
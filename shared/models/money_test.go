@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "12.50", want: 1250},
+		{in: "12.5", want: 1250},
+		{in: "12", want: 1200},
+		{in: "12.", want: 1200},
+		{in: ".5", want: 50},
+		{in: " 0.01 ", want: 1},
+		{in: "-3.25", want: -325},
+		{in: "0", want: 0},
+		{in: "900719925474.09", want: MaxMoney},
+		{in: "-900719925474.09", want: -MaxMoney},
+		{in: "900719925474.10", wantErr: true},
+		{in: "900719925475", wantErr: true},
+		{in: "92233720368547758.07", wantErr: true}, // Would overflow int64 in cents
+		{in: "4611686018427387905", wantErr: true},  // Wraps to 100 cents when multiplied by 100
+		{in: "99999999999999999999", wantErr: true},
+		{in: "12.+5", wantErr: true},
+		{in: "12.-5", wantErr: true},
+		{in: "+12", wantErr: true},
+		{in: "--12", wantErr: true},
+		{in: "12.5a", wantErr: true},
+		{in: "1_000", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "12.505", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: `150.50`, want: 15050},
+		{in: `"150.50"`, want: 15050},
+		{in: `150`, want: 15000},
+		{in: `-0.5`, want: -50},
+		{in: `0.30000000000000004`, want: 30}, // Float client arithmetic
+		{in: `1.005e2`, want: 10050},
+		{in: `900719925474.09`, want: MaxMoney},
+		{in: `4611686018427387905`, wantErr: true},
+		{in: `"4611686018427387905"`, wantErr: true},
+		{in: `1e300`, wantErr: true},
+		{in: `900719925475`, wantErr: true},
+		{in: `"12.+5"`, wantErr: true},
+		{in: `"12.505"`, wantErr: true}, // Strings are exact, never rounded
+		{in: `"abc"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got struct {
+			Amount Money `json:"amount"`
+		}
+		err := json.Unmarshal([]byte(`{"amount":`+tt.in+`}`), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s = %d, want an error", tt.in, got.Amount)
+			}
+			continue
+		}
+		if err != nil || got.Amount != tt.want {
+			t.Errorf("unmarshal %s = %d, %v, want %d", tt.in, got.Amount, err, tt.want)
+			continue
+		}
+
+		// Round trip: what is written reads back the same
+		data, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back struct {
+			Amount Money `json:"amount"`
+		}
+		if err := json.Unmarshal(data, &back); err != nil || back.Amount != got.Amount {
+			t.Errorf("round trip of %s through %s = %d, %v, want %d", tt.in, data, back.Amount, err, got.Amount)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	for m, want := range map[Money]string{
+		0:         "0.00",
+		5:         "0.05",
+		1250:      "12.50",
+		-325:      "-3.25",
+		-5:        "-0.05",
+		MaxMoney:  "900719925474.09",
+		-MaxMoney: "-900719925474.09",
+	} {
+		if got := m.String(); got != want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(m), got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Personal event types, carried in the "type" field of every event published on
+// user_events.{userID}
+const (
+	EventTypeOutbid       = "outbid"
+	EventTypeBidConfirmed = "bid_confirmed"
+	EventTypeAuctionWon   = "auction_won"
+	EventTypeAuctionLost  = "auction_lost"
+)
+
+// OutbidEvent tells a bidder that another bid displaced them as the highest bidder
+type OutbidEvent struct {
+	Type       string    `json:"type"` // EventTypeOutbid
+	EventID    string    `json:"event_id"`
+	UserID     string    `json:"user_id"` // The displaced bidder
+	ItemID     string    `json:"item_id"`
+	CurrentBid Money     `json:"current_bid"` // Price that displaced them
+	MinNextBid Money     `json:"min_next_bid"`
+	Currency   string    `json:"currency"`
+	EndTime    time.Time `json:"end_time"`
+	Seq        int64     `json:"seq"` // Item sequence number of the displacing bid
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// BidConfirmedEvent confirms an accepted bid to the bidder, on all of their
+// connections (e.g. the bid was placed from another device)
+type BidConfirmedEvent struct {
+	Type       string    `json:"type"` // EventTypeBidConfirmed
+	EventID    string    `json:"event_id"`
+	UserID     string    `json:"user_id"` // The bidder
+	ItemID     string    `json:"item_id"`
+	YourBid    Money     `json:"your_bid"`
+	YourMax    Money     `json:"your_max,omitempty"`    // Only present for proxy bids
+	CurrentBid Money     `json:"current_bid,omitempty"` // Absent for sealed bids
+	IsHighest  bool      `json:"is_highest"`
+	Currency   string    `json:"currency"`
+	Sealed     bool      `json:"sealed,omitempty"`
+	Seq        int64     `json:"seq"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// AuctionResultEvent tells a bidder how an auction they bid on ended: the winner
+// gets EventTypeAuctionWon, every other bidder EventTypeAuctionLost
+type AuctionResultEvent struct {
+	Type       string    `json:"type"` // EventTypeAuctionWon or EventTypeAuctionLost
+	EventID    string    `json:"event_id"`
+	UserID     string    `json:"user_id"` // The bidder
+	ItemID     string    `json:"item_id"`
+	Name       string    `json:"name"`
+	FinalPrice Money     `json:"final_price"`
+	Currency   string    `json:"currency"`
+	ReserveMet bool      `json:"reserve_met"` // False if nobody won because of the reserve price
+	BuyNow     bool      `json:"buy_now,omitempty"`
+	ClosedAt   time.Time `json:"closed_at"`
+}